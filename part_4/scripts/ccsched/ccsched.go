@@ -2,31 +2,171 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	"ethz.ch/ccsched/controller"
+	"ethz.ch/ccsched/history"
+	"ethz.ch/ccsched/jobs"
+	"ethz.ch/ccsched/probe"
 	"ethz.ch/ccsched/scheduler"
-	"github.com/docker/docker/client"
 )
 
-type Scheduler interface {
-	// Initialize the Scheduler and create jobs.
-	Init(ctx context.Context, cli *controller.Controller)
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Usage: ccsched [--scheduler <name>] [--jobs <manifest.json>] [--probe <addr> | --mcperf <file>] [--slo <latency>]")
+	fmt.Fprintln(out, "               [--reserved-cpus <cpus>] [--psi with-usage|only] [--state-dir <dir>] <result-dir>")
+	fmt.Fprintln(out, "       ccsched [--scheduler <name>] [--jobs <manifest.json>] simulate [flags] <result-dir>")
+	fmt.Fprintln(out, "       ccsched [--scheduler <name>] [--jobs <manifest.json>] replay ingest|run [flags] ...")
+	fmt.Fprintln(out, "       ccsched list-schedulers")
+	fmt.Fprintln(out, "       ccsched [--state-dir <dir>] history list|show|jobs|export")
+	flag.PrintDefaults()
+}
+
+func listSchedulers() {
+	for _, info := range scheduler.List() {
+		fmt.Printf("%-12v %v\n", info.Name, info.Description)
+	}
+}
 
-	// Execute the scheduler.
-	Run(ctx context.Context, cli *controller.Controller)
+// Add the run to the history in the state directory.
+func recordRun(stateDir, schedName string, started time.Time, resultDir string, summary controller.Summary, interrupted bool) error {
+	store, err := history.Open(historyFile(stateDir))
+	if err != nil {
+		return err
+	}
+	if dir, err := filepath.Abs(resultDir); err == nil {
+		resultDir = dir
+	}
+	run := history.NewRun(schedName, started, resultDir, summary)
+	run.Interrupted = interrupted
+	return store.Add(run)
+}
+
+// The jobs of the manifest, or the built-in jobs.
+func loadJobs(jobsFile string) ([]controller.JobInfo, error) {
+	if jobsFile != "" {
+		return controller.LoadJobManifest(jobsFile)
+	}
+	return jobs.Builtin()
+}
+
+// ~/.ccsched, or .ccsched in the working directory if there is no home.
+func defaultStateDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".ccsched"
+	}
+	return path.Join(home, ".ccsched")
 }
 
 func main() {
-	if len(os.Args) <= 1 {
-		fmt.Println("Usage: ccsched <result-dir>")
+	schedName := flag.String("scheduler", "mc1", "name of the scheduling policy (see list-schedulers)")
+	jobsFile := flag.String("jobs", "", "JSON job manifest (default: the built-in PARSEC jobs)")
+	probeAddr := flag.String("probe", "", "host:port of memcached to probe, to steer it by its p95 latency instead of cpu usage")
+	mcperfFile := flag.String("mcperf", "", "mcperf output to follow, to steer memcached by its p95 latency instead of cpu usage")
+	memcachedPidfile := flag.String("memcached-pidfile", "", "pidfile of memcached (default: find the process named memcached)")
+	memcachedCgroup := flag.String("memcached-cgroup", "", "cgroup directory of memcached, all of its processes are pinned")
+	memcachedAddr := flag.String("memcached-addr", "", "host:port of memcached, to check its health before the run")
+	memcachedThreads := flag.Int("memcached-threads", 0, "restart memcached with this many threads before the run, needs root (default: keep them)")
+	reservedCpus := flag.String("reserved-cpus", "", "cpus reserved for memcached, e.g. 0-1 (default: the first two online cpus)")
+	avoidSiblings := flag.Bool("avoid-memcached-siblings", false, "never run jobs on SMT siblings of the cpus of memcached")
+	sameNode := flag.Bool("same-node", false, "keep the cpus of a job within one NUMA node")
+	slo := flag.Duration("slo", controller.DefaultSLO, "p95 latency target of memcached")
+	stateDir := flag.String("state-dir", defaultStateDir(), "directory of the state kept across runs, such as the job run times")
+	psiMode := flag.String("psi", "", "steer memcached by its cpu pressure stalls along with cpu usage (with-usage) or instead of it (only)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if flag.Arg(0) == "list-schedulers" {
+		listSchedulers()
+		return
+	}
+	if flag.Arg(0) == "history" {
+		if err := runHistory(*stateDir, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	resultDir := flag.Arg(0)
+	reserved, err := controller.ParseCpuList(*reservedCpus)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *probeAddr != "" && *mcperfFile != "" {
+		fmt.Fprintln(os.Stderr, "--probe and --mcperf are mutually exclusive")
+		os.Exit(1)
+	}
+	if *psiMode != "" && *psiMode != "with-usage" && *psiMode != "only" {
+		fmt.Fprintf(os.Stderr, "unknown --psi mode %q\n", *psiMode)
+		os.Exit(1)
+	}
+	placement := controller.PlacementPolicy{AvoidMemcachedSiblings: *avoidSiblings, SameNode: *sameNode}
+
+	if cmd := flag.Arg(0); cmd == "simulate" || cmd == "replay" {
+		allJobs, err := loadJobs(*jobsFile)
+		if err == nil {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			run := runFlags{
+				schedName: *schedName,
+				jobs:      allJobs,
+				reserved:  reserved,
+				placement: placement,
+				slo:       *slo,
+				psiMode:   *psiMode,
+			}
+			if cmd == "simulate" {
+				err = runSimulation(ctx, run, flag.Args()[1:])
+			} else {
+				err = runReplay(ctx, run, flag.Args()[1:])
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	topology, err := controller.DiscoverTopology()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "discover cpu topology:", err)
+		os.Exit(1)
+	}
+	if len(reserved) > 0 {
+		if err := topology.CheckReserved(reserved); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	sched, err := scheduler.New(*schedName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	allJobs, err := loadJobs(*jobsFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	resultDir := os.Args[1]
 
 	if err := os.MkdirAll(resultDir, 0755); err != nil {
 		panic(err)
@@ -38,33 +178,123 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	mw := io.MultiWriter(os.Stdout, logFile)
+	// The log file comes first so that it keeps being written if stdout breaks.
+	mw := io.MultiWriter(logFile, os.Stdout)
 	log.SetOutput(mw)
 
-	ctx := context.Background()
-	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	// Cancel the run on Ctrl-C, kill, or when the ssh session running us goes away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer stop()
+	// A lost ssh session must not kill us on the next write to stdout.
+	signal.Ignore(syscall.SIGPIPE)
+
+	runtime, err := controller.NewDockerRuntime()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	cli := &controller.Controller{Client: dockerClient}
-	allJobs := []controller.JobInfo{
-		{Name: "blackscholes"},
-		{Name: "ferret"},
-		{Name: "freqmine"},
-		{Name: "dedup"},
-		{Name: "canneal"},
-		{Name: "splash2x-fft"},
+	eventLog, err := controller.OpenEventLog(path.Join(resultDir, "events.jsonl"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer eventLog.Close()
+
+	store, err := history.Open(historyFile(*stateDir))
+	if err != nil {
+		log.Fatal("Error loading the job history: ", err)
+	}
+
+	memcached := &controller.MemcachedService{
+		Process: controller.ProcessPinner{Pidfile: *memcachedPidfile, Cgroup: *memcachedCgroup},
+		Addr:    *memcachedAddr,
+	}
+	cli := &controller.Controller{
+		Runtime:   runtime,
+		Memcached: memcached,
+		Topology:  topology,
+		Reserved:  reserved,
+		Placement: placement,
+		SLO:       *slo,
+		Eta:       controller.NewEtaModel(store.JobRuns()),
+		EventLog:  eventLog,
+	}
+	log.Printf("Topology: %v, reserved for memcached: %v", topology, cli.ReservedCpus())
+	if *probeAddr != "" {
+		prober := probe.NewProber(*probeAddr, probe.DefaultWindow)
+		go prober.Run(ctx)
+		cli.Latency = prober
+	} else if *mcperfFile != "" {
+		mcperf, err := controller.OpenMcperfLog(*mcperfFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer mcperf.Close()
+		cli.Latency = mcperf
+	}
+	if *psiMode != "" {
+		psi := &controller.PressureSampler{}
+		if cgroup, err := memcached.Cgroup(); err != nil {
+			log.Println("Error finding the cgroup of memcached, using the cpu pressure of the host:", err)
+		} else if _, err := controller.ReadPressure(path.Join(cgroup, "cpu.pressure")); err != nil {
+			log.Println("No cpu pressure for the cgroup of memcached, using that of the host:", err)
+		} else {
+			psi.Cgroup = cgroup
+		}
+		// The first sample only sets the baseline, but fails if the host has no PSI.
+		if _, err := psi.Pressure(); err != nil && !errors.Is(err, controller.ErrNoPressure) {
+			log.Println("No cpu pressure on the host, steering memcached by cpu usage only:", err)
+		} else {
+			cli.Pressure = psi
+			cli.PressureOnly = *psiMode == "only"
+		}
+	}
+
+	if *memcachedThreads > 0 {
+		if err := cli.SetMemcachedThreads(ctx, *memcachedThreads); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := cli.MemcachedHealth(ctx); err != nil {
+		log.Println("memcached is not healthy:", err)
 	}
 
 	// Remove any existing containers.
 	cli.RemoveContainers(ctx, allJobs)
 
-	var sched Scheduler = &scheduler.MC1Scheduler{}
-	log.Printf("Running with scheduler %T", sched)
-	defer cli.RemoveContainers(ctx, allJobs)
-	sched.Init(ctx, cli)
-	sched.Run(ctx, cli)
-	cli.WriteLogs(ctx, resultDir, allJobs)
+	log.Printf("Running with scheduler %v (%T)", *schedName, sched)
+	started := time.Now()
+	err = sched.Init(ctx, cli, allJobs)
+	if err != nil {
+		log.Println("Error initializing scheduler:", err)
+	} else {
+		err = sched.Run(ctx, cli)
+		if err != nil {
+			log.Println("Error running scheduler:", err)
+		}
+	}
 
+	// Clean up even if the run was interrupted, so that no paused jobs are left behind.
+	// Stop listening for signals to let a second Ctrl-C abort the cleanup.
+	stop()
+	if ctx.Err() != nil {
+		log.Println("Run interrupted, saving partial results")
+	}
+	cleanupCtx := controller.WithReason(context.Background(), controller.ReasonShutdown)
+	cli.StopJobs(cleanupCtx, allJobs)
+	// Give memcached back all of its cpus, as set up by run_scheduler.sh.
+	if err := cli.SetMemcachedCpuAffinity(cleanupCtx, cli.ReservedCpus()); err != nil {
+		log.Println("Error restoring memcached affinity:", err)
+	}
+	if err := cli.WriteLogs(cleanupCtx, resultDir, allJobs); err != nil {
+		log.Println("Error writing logs:", err)
+	}
+	summary := cli.Summary()
+	if err := summary.Write(resultDir); err != nil {
+		log.Println("Error writing summary:", err)
+	}
+	summary.WriteTable(os.Stdout)
+	if err := recordRun(*stateDir, *schedName, started, resultDir, summary, ctx.Err() != nil); err != nil {
+		log.Println("Error recording the run in the history:", err)
+	}
+	cli.RemoveContainers(cleanupCtx, allJobs)
 }
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Implemented by runtimes that account the cpu time of their jobs, e.g. through cgroups.
+type CpuAccountingRuntime interface {
+	// Cumulative cpu time used by a job. Fails with ErrConflict if it has not started yet.
+	CpuUsage(ctx context.Context, id string) (time.Duration, error)
+}
+
+// Implemented by services that account their cpu time.
+type CpuAccountingService interface {
+	// Cumulative cpu time used by the service.
+	CpuUsage(ctx context.Context) (time.Duration, error)
+}
+
+// Name of memcached in the per-service utilization.
+const memcachedServiceName = "memcached"
+
+// A reading of the cumulative cpu time of a job or service.
+type cpuReading struct {
+	usage time.Duration
+	at    time.Time
+}
+
+// Last cpu time read from the jobs and services, to turn the cumulative cpu time
+// into utilization.
+type cpuAccounts struct {
+	mu       sync.Mutex
+	jobs     []string  // Created jobs, in creation order.
+	at       time.Time // Time of the previous sample.
+	job      map[string]cpuReading
+	service  map[string]cpuReading
+	failures map[string]bool // Jobs and services whose failure has been logged.
+}
+
+func (a *cpuAccounts) addJob(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, job := range a.jobs {
+		if job == id {
+			return
+		}
+	}
+	a.jobs = append(a.jobs, id)
+}
+
+func (a *cpuAccounts) removeJob(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, job := range a.jobs {
+		if job == id {
+			a.jobs = append(a.jobs[:i], a.jobs[i+1:]...)
+			break
+		}
+	}
+	delete(a.job, id)
+}
+
+// Log a failure once per job or service, as it would repeat at every sample.
+func (a *cpuAccounts) fail(name string, err error) {
+	if a.failures == nil {
+		a.failures = make(map[string]bool)
+	}
+	if !a.failures[name] {
+		a.failures[name] = true
+		log.Printf("Error accounting cpu time of %v: %v", name, err)
+	}
+}
+
+// Utilization of the jobs and services since the previous call, in percent of a single cpu.
+// Both are nil if nothing accounts cpu time, or on the first call. Jobs that have not
+// started or have exited, and services without an earlier reading, are left out.
+func (cli *Controller) cpuAccounting(ctx context.Context) (jobs, services map[string]float64) {
+	rt, jobsAccounted := cli.Runtime.(CpuAccountingRuntime)
+	memcached, memcachedAccounted := cli.memcached().(CpuAccountingService)
+	if !jobsAccounted && !memcachedAccounted {
+		return nil, nil
+	}
+
+	a := &cli.accounts
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := cli.Now()
+	if a.job == nil {
+		a.job = make(map[string]cpuReading)
+		a.service = make(map[string]cpuReading)
+	}
+	if !a.at.IsZero() {
+		jobs = make(map[string]float64)
+		services = make(map[string]float64)
+	}
+	// Utilization since the previous reading, if any.
+	percent := func(prev cpuReading, usage time.Duration) (float64, bool) {
+		elapsed := now.Sub(prev.at)
+		if prev.at.IsZero() || elapsed <= 0 {
+			return 0, false
+		}
+		return 100 * float64(usage-prev.usage) / float64(elapsed), true
+	}
+
+	if jobsAccounted {
+		for _, id := range a.jobs {
+			usage, err := rt.CpuUsage(ctx, id)
+			if errors.Is(err, ErrConflict) || errors.Is(err, ErrAlreadyExited) {
+				continue
+			} else if err != nil {
+				a.fail(id, err)
+				continue
+			}
+			prev, ok := a.job[id]
+			if !ok {
+				// The job has started since the previous sample, without any cpu time before.
+				prev = cpuReading{at: a.at}
+			}
+			if p, ok := percent(prev, usage); ok && jobs != nil {
+				jobs[id] = p
+			}
+			a.job[id] = cpuReading{usage, now}
+		}
+	}
+
+	if memcachedAccounted {
+		usage, err := memcached.CpuUsage(ctx)
+		if err != nil {
+			a.fail(memcachedServiceName, err)
+		} else {
+			if p, ok := percent(a.service[memcachedServiceName], usage); ok && services != nil {
+				services[memcachedServiceName] = p
+			}
+			a.service[memcachedServiceName] = cpuReading{usage, now}
+		}
+	}
+	a.at = now
+	return jobs, services
+}
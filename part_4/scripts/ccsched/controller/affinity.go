@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ProcessPinner pins every thread of a process to a set of cpus with sched_setaffinity.
+// The process is looked up by Pidfile, Cgroup or Name, the first one set wins. Pinning
+// the threads of another user needs CAP_SYS_NICE.
+type ProcessPinner struct {
+	Name    string // Command name, as in /proc/<pid>/comm. Must match exactly one process.
+	Pidfile string // File holding the pid.
+	Cgroup  string // Cgroup directory, e.g. /sys/fs/cgroup/system.slice/memcached.service. All its processes are pinned.
+}
+
+// A thread whose affinity could not be set.
+type ThreadError struct {
+	Pid, Tid int
+	Err      error
+}
+
+func (e ThreadError) Error() string {
+	return fmt.Sprintf("thread %v of process %v: %v", e.Tid, e.Pid, e.Err)
+}
+
+// The affinity could not be set on some threads. The other threads have been pinned.
+type AffinityError struct {
+	Threads []ThreadError
+}
+
+func (e *AffinityError) Error() string {
+	msgs := make([]string, len(e.Threads))
+	for i, t := range e.Threads {
+		msgs[i] = t.Error()
+	}
+	return "set cpu affinity: " + strings.Join(msgs, "; ")
+}
+
+func (p *ProcessPinner) SetCpuAffinity(cpuList CpuList) error {
+	pids, err := p.pids()
+	if err != nil {
+		return err
+	}
+	var failed []ThreadError
+	for _, pid := range pids {
+		tids, err := threads(pid)
+		if err != nil {
+			return err
+		}
+		for _, tid := range tids {
+			if err := setThreadAffinity(tid, cpuList); err != nil {
+				failed = append(failed, ThreadError{Pid: pid, Tid: tid, Err: err})
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return &AffinityError{Threads: failed}
+	}
+	return nil
+}
+
+// The processes to pin.
+func (p *ProcessPinner) pids() ([]int, error) {
+	switch {
+	case p.Pidfile != "":
+		data, err := ioutil.ReadFile(p.Pidfile)
+		if err != nil {
+			return nil, err
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("pidfile %v: %w", p.Pidfile, err)
+		}
+		return []int{pid}, nil
+
+	case p.Cgroup != "":
+		pids, err := readPids(path.Join(p.Cgroup, "cgroup.procs"))
+		if err != nil {
+			return nil, err
+		}
+		if len(pids) == 0 {
+			return nil, fmt.Errorf("%w in cgroup %v", ErrNoProcess, p.Cgroup)
+		}
+		return pids, nil
+
+	default:
+		pids, err := pidsByName(p.Name)
+		if err != nil {
+			return nil, err
+		}
+		if len(pids) != 1 {
+			if len(pids) == 0 {
+				return nil, fmt.Errorf("%w: %v", ErrNoProcess, p.Name)
+			}
+			return nil, fmt.Errorf("%v processes named %v: %v", len(pids), p.Name, pids)
+		}
+		return pids, nil
+	}
+}
+
+func pidsByName(name string) ([]int, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		comm, err := ioutil.ReadFile(path.Join("/proc", entry.Name(), "comm"))
+		if err != nil {
+			continue // The process has exited.
+		}
+		if strings.TrimSpace(string(comm)) == name {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// The threads of a process.
+func threads(pid int) ([]int, error) {
+	entries, err := ioutil.ReadDir(path.Join("/proc", strconv.Itoa(pid), "task"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %v", ErrNoProcess, pid)
+	} else if err != nil {
+		return nil, err
+	}
+	tids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		if tid, err := strconv.Atoi(entry.Name()); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	return tids, nil
+}
+
+// Read a list of pids, one per line.
+func readPids(file string) ([]int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pids []int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		pid, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", file, err)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, scanner.Err()
+}
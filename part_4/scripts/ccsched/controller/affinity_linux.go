@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Set and verify the affinity of a thread. A thread that exits meanwhile needs no pinning.
+func setThreadAffinity(tid int, cpuList CpuList) error {
+	var mask unix.CPUSet
+	for _, cpu := range cpuList {
+		mask.Set(cpu)
+	}
+	err := unix.SchedSetaffinity(tid, &mask)
+	if errors.Is(err, unix.ESRCH) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var actual unix.CPUSet
+	err = unix.SchedGetaffinity(tid, &actual)
+	if errors.Is(err, unix.ESRCH) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if actual != mask {
+		var cpus CpuList
+		for cpu := 0; cpu < len(actual)*64; cpu++ {
+			if actual.IsSet(cpu) {
+				cpus = append(cpus, cpu)
+			}
+		}
+		return fmt.Errorf("affinity is %v instead of %v", cpus, cpuList)
+	}
+	return nil
+}
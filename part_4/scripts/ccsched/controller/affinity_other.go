@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package controller
+
+import "errors"
+
+func setThreadAffinity(tid int, cpuList CpuList) error {
+	return errors.New("setting the cpu affinity of threads is only supported on linux")
+}
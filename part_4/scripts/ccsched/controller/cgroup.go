@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mount point of the cgroup hierarchies.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// Cumulative cpu time used by the processes of a cgroup, read from cpu.stat under
+// cgroup v2 or cpuacct.usage under cgroup v1.
+func CgroupCpuUsage(dir string) (time.Duration, error) {
+	f, err := os.Open(path.Join(dir, "cpu.stat"))
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 2 && fields[0] == "usage_usec" {
+				us, err := strconv.ParseInt(fields[1], 10, 64)
+				if err != nil {
+					return 0, fmt.Errorf("%v: %w", f.Name(), err)
+				}
+				return time.Duration(us) * time.Microsecond, nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return 0, err
+		}
+		// Under cgroup v1, cpu.stat only holds throttling statistics.
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	data, err := ioutil.ReadFile(path.Join(dir, "cpuacct.usage"))
+	if err != nil {
+		return 0, err
+	}
+	ns, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%v: %w", path.Join(dir, "cpuacct.usage"), err)
+	}
+	return time.Duration(ns), nil
+}
+
+// The cgroup directory that accounts the cpu time of a process: its cgroup v2 directory,
+// or its directory in the cpuacct hierarchy under cgroup v1.
+func ProcessCgroup(pid int) (string, error) {
+	file := path.Join("/proc", strconv.Itoa(pid), "cgroup")
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("%w: %v", ErrNoProcess, pid)
+	} else if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// Lines are hierarchy-ID:controllers:path, with an empty list of controllers for v2.
+	var unified string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[1] == "" {
+			unified = fields[2]
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			if controller != "cpuacct" {
+				continue
+			}
+			// The hierarchy is mounted under the list of its controllers, e.g. cpu,cpuacct.
+			for _, mount := range []string{fields[1], "cpuacct"} {
+				dir := path.Join(cgroupRoot, mount, fields[2])
+				if _, err := os.Stat(dir); err == nil {
+					return dir, nil
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if unified == "" {
+		return "", fmt.Errorf("%v: no cpu accounting cgroup", file)
+	}
+	return path.Join(cgroupRoot, unified), nil
+}
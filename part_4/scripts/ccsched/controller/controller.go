@@ -3,32 +3,58 @@ package controller
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/stdcopy"
 )
 
+// Time given to a job to exit before it is killed.
+const stopTimeout = 10 * time.Second
+
+// Controller drives the jobs through a Runtime and pins memcached on the host.
+// Clock, Sampler, Memcached and Topology default to the host when left nil.
+// Schedulers steer memcached by its latency if Latency is set, by cpu usage otherwise,
+// along with its cpu stalls if Pressure is set. Every action is recorded in EventLog, if set.
 type Controller struct {
-	*client.Client
+	Runtime   Runtime
+	Clock     Clock
+	Sampler   CpuSampler
+	Memcached Service
+	Topology  *Topology
+	Reserved  CpuList // Cpus for memcached, the first two online cpus if nil.
+	Placement PlacementPolicy
+	Latency   LatencySource
+	SLO       time.Duration // Latency target of memcached, DefaultSLO if zero.
+	Pressure  PressureSource
+	Eta       *EtaModel // Learns the run time of the jobs, from no past runs if nil.
+	// Steer memcached by its cpu stalls alone rather than alongside its cpu usage.
+	PressureOnly bool
+	EventLog     *EventLog
+
+	memcachedCpus   CpuList // Last cpus memcached was pinned to, see MemcachedCpus.
+	stats           runStats
+	accounts        cpuAccounts
+	pressureFailing bool // Whether the last pressure sample failed.
 }
 type CpuList []int
 
 type JobInfo struct {
-	Name         string        // Name of the job.
-	Threads      int           // Number of threads to run the job.
-	CpuList      CpuList       // The cpus that the job is running on.
-	Eta          time.Duration // Estimated finish time of the job.
-	LastUnpaused time.Time     // Time when the job was last unpaused.
+	Name         string            // Name of the job.
+	Image        string            // Image to run, defaults to the PARSEC image of the job.
+	Command      []string          // Entrypoint override, if any.
+	Args         []string          // Arguments, defaults to parsecmgmt for PARSEC images.
+	Env          map[string]string // Extra environment variables.
+	WorkingDir   string            // Working directory inside the container, if not the image's.
+	Threads      int               // Number of threads to run the job.
+	Priority     int               // Jobs with higher priority are scheduled first.
+	Dependencies []string          // Jobs that must complete successfully before this one starts.
+	BatchOnly    bool              // Keep the job off the reserved cpus that memcached lends, unless there are no others.
+	CpuList      CpuList           // The cpus that the job is running on.
+	Eta          time.Duration     // Estimated time left until the job finishes.
 }
 
 func (cpuList CpuList) String() string {
@@ -39,68 +65,119 @@ func (cpuList CpuList) String() string {
 	return strings.Join(cpuStrList, ",")
 }
 
-func getStartCommand(job *JobInfo) []string {
-	pkg := job.Name
-	if pkg == "splash2x-fft" {
-		pkg = "splash2x.fft"
+// Create a single job.
+func (cli *Controller) CreateJob(ctx context.Context, job *JobInfo) error {
+	if err := cli.Runtime.Create(ctx, job); err != nil {
+		return cli.jobError(ctx, "create", job.Name, err)
 	}
-	return []string{"./bin/parsecmgmt", "-a", "run",
-		"-p", pkg, "-i", "native", "-n", strconv.Itoa(job.Threads)}
+	log.Println("Created job", job.Name)
+	cli.etaModel().created(job)
+	cli.accounts.addJob(job.Name)
+	cli.RecordEvent(ctx, Event{Type: EventJobCreated, Job: job.Name, Threads: job.Threads})
+	return nil
 }
 
-// Create a single job.
-func (cli *Controller) CreateJob(ctx context.Context, job *JobInfo) {
-	id := job.Name
-	imageName := fmt.Sprintf("anakli/parsec:%v-native-reduced", id)
+// Start a job that has been created.
+func (cli *Controller) StartJob(ctx context.Context, id string) error {
+	if err := cli.Runtime.Start(ctx, id); err != nil {
+		return cli.jobError(ctx, "start", id, err)
+	}
+	log.Println("Started job", id)
+	cli.RecordEvent(ctx, Event{Type: EventJobStarted, Job: id})
+	return nil
+}
 
-	_, err := cli.ImagePull(ctx, imageName, types.ImagePullOptions{})
-	if err != nil {
-		log.Fatal(err)
+// Pausing a job could fail with ErrAlreadyExited if it has already finished,
+// but the scheduler is not aware of it yet.
+func (cli *Controller) PauseJob(ctx context.Context, id string) error {
+	if err := cli.Runtime.Pause(ctx, id); err != nil {
+		return cli.jobError(ctx, "pause", id, err)
 	}
+	log.Println("Paused job", id)
+	cli.RecordEvent(ctx, Event{Type: EventJobPaused, Job: id})
+	return nil
+}
 
-	command := getStartCommand(job)
-	_, err = cli.ContainerCreate(ctx, &container.Config{
-		Image: imageName,
-		Cmd:   command,
-	}, nil, nil, nil, id)
-	if err != nil {
-		log.Fatal(err)
+func (cli *Controller) UnpauseJob(ctx context.Context, id string) error {
+	if err := cli.Runtime.Unpause(ctx, id); err != nil {
+		return cli.jobError(ctx, "unpause", id, err)
 	}
+	log.Println("Unpaused job", id)
+	cli.RecordEvent(ctx, Event{Type: EventJobUnpaused, Job: id})
+	return nil
+}
 
-	log.Println("Created job", id)
+// Current time according to the controller's clock.
+func (cli *Controller) Now() time.Time {
+	if cli.Clock == nil {
+		return time.Now()
+	}
+	return cli.Clock.Now()
+}
 
+// Utilization of every cpu, measured over the given interval.
+func (cli *Controller) CpuPercent(interval time.Duration) ([]float64, error) {
+	if cli.Sampler == nil {
+		return hostSampler{}.Percent(interval)
+	}
+	return cli.Sampler.Percent(interval)
 }
 
-// Start a job that has been created.
-func (cli *Controller) StartJob(ctx context.Context, id string) {
-	if err := cli.ContainerStart(ctx, id,
-		types.ContainerStartOptions{}); err != nil {
-		log.Fatal(err)
+// The online cpus, discovered from sysfs unless Topology is set.
+func (cli *Controller) CpuTopology() *Topology {
+	if cli.Topology == nil {
+		topo, err := DiscoverTopology()
+		if err != nil {
+			log.Println("Error discovering cpu topology, assuming one cpu per core:", err)
+			topo = UniformTopology(runtime.NumCPU())
+		}
+		cli.Topology = topo
 	}
-	log.Println("Started job", id)
+	return cli.Topology
 }
 
-// Pausing a job could fail if it has already finished, but the scheduler is not aware of it yet.
-func (cli *Controller) PauseJob(ctx context.Context, id string) (err error) {
-	err = cli.ContainerPause(ctx, id)
-	if err == nil {
-		log.Println("Paused job", id)
+// The cpus set aside for memcached. Schedulers may lend all but the first one to jobs.
+func (cli *Controller) ReservedCpus() CpuList {
+	if cli.Reserved != nil {
+		return cli.Reserved
 	}
-	return
+	online := cli.CpuTopology().Online()
+	if len(online) > 2 {
+		return online[:2]
+	}
+	return online[:1]
 }
 
-func (cli *Controller) UnpauseJob(ctx context.Context, id string) {
-	if err := cli.ContainerUnpause(ctx, id); err != nil {
-		log.Fatal(err)
+// The cpus for jobs only: the online cpus that are not reserved for memcached.
+func (cli *Controller) BatchCpus() CpuList {
+	reserved := make(map[int]bool)
+	for _, cpu := range cli.ReservedCpus() {
+		reserved[cpu] = true
 	}
-	log.Println("Unpaused job", id)
+	var cpus CpuList
+	for _, cpu := range cli.CpuTopology().Online() {
+		if !reserved[cpu] {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus
+}
+
+// Get the current state of a job.
+func (cli *Controller) JobStatus(ctx context.Context, id string) (JobStatus, error) {
+	status, err := cli.Runtime.Inspect(ctx, id)
+	if err != nil {
+		return status, &JobError{Op: "inspect", Job: id, Err: err}
+	}
+	return status, nil
 }
 
 // Stops and remove the jobs in the job list.
 func (cli *Controller) RemoveContainers(ctx context.Context, jobs []JobInfo) {
 	for _, job := range jobs {
 		id := job.Name
-		err := cli.ContainerRemove(ctx, id, types.ContainerRemoveOptions{Force: true})
+		cli.accounts.removeJob(id)
+		err := cli.Runtime.Remove(ctx, id)
 		if err != nil {
 			log.Printf("Error removing job %v: %v", id, err)
 		} else {
@@ -110,44 +187,97 @@ func (cli *Controller) RemoveContainers(ctx context.Context, jobs []JobInfo) {
 
 }
 
-func (cli *Controller) SetJobCpuAffinity(ctx context.Context, job *JobInfo, cpuList CpuList) {
-	if _, err := cli.ContainerUpdate(ctx, job.Name, container.UpdateConfig{
-		Resources: container.Resources{
-			CpusetCpus: cpuList.String(),
-		},
-	}); err != nil {
-		log.Fatal(err)
+// Stop all jobs that are still running or paused, e.g. when a run is interrupted.
+// Paused jobs are unpaused first so that they can exit cleanly.
+func (cli *Controller) StopJobs(ctx context.Context, jobs []JobInfo) {
+	for _, job := range jobs {
+		id := job.Name
+		status, err := cli.Runtime.Inspect(ctx, id)
+		if err != nil {
+			log.Printf("Error inspecting job %v: %v", id, err)
+			continue
+		}
+		if status.State == StatePaused {
+			if err := cli.UnpauseJob(ctx, id); err != nil {
+				log.Println(err)
+				continue
+			}
+			status.State = StateRunning
+		}
+		if status.State == StateRunning {
+			if err := cli.Runtime.Stop(ctx, id, stopTimeout); err != nil {
+				log.Printf("Error stopping job %v: %v", id, err)
+			} else {
+				log.Println("Stopped job", id)
+				cli.RecordEvent(ctx, Event{Type: EventJobStopped, Job: id})
+			}
+		}
+	}
+}
+
+func (cli *Controller) SetJobCpuAffinity(ctx context.Context, job *JobInfo, cpuList CpuList) error {
+	if err := cli.Runtime.SetCpuset(ctx, job.Name, cpuList); err != nil {
+		return cli.jobError(ctx, "set cpus of", job.Name, err)
 	}
 	job.CpuList = cpuList
 	log.Printf("Job %v running on cpu %v", job.Name, cpuList)
+	cli.RecordEvent(ctx, Event{Type: EventJobCpuset, Job: job.Name, Cpuset: cpuList})
+	return nil
 }
 
-func (cli *Controller) SetMemcachedCpuAffinity(cpuList CpuList) {
-	cmd := exec.Command("bash", "-c",
-		"pidof memcached | xargs sudo taskset -a -cp "+cpuList.String())
+func (cli *Controller) memcached() Service {
+	if cli.Memcached == nil {
+		return &MemcachedService{}
+	}
+	return cli.Memcached
+}
 
-	if err := cmd.Run(); err != nil {
-		log.Fatal(err)
+func (cli *Controller) SetMemcachedCpuAffinity(ctx context.Context, cpuList CpuList) error {
+	if err := cli.memcached().SetCpuAffinity(ctx, cpuList); err != nil {
+		return fmt.Errorf("pin memcached to cpu %v: %w", cpuList, err)
 	}
 	log.Println("memcached running on cpu", cpuList)
+	cli.memcachedCpus = append(CpuList(nil), cpuList...)
+	cli.RecordEvent(ctx, Event{Type: EventMemcachedCpus, Cpuset: cpuList})
+	return nil
 }
 
-func (cli *Controller) WriteLogs(ctx context.Context, resultDir string, jobs []JobInfo) {
+// Restart memcached with the given number of threads, keeping it on its cpus.
+func (cli *Controller) SetMemcachedThreads(ctx context.Context, threads int) error {
+	memcached := cli.memcached()
+	if err := memcached.SetThreads(ctx, threads); err != nil {
+		return fmt.Errorf("set memcached threads to %v: %w", threads, err)
+	}
+	log.Println("memcached running with threads", threads)
+	cli.RecordEvent(ctx, Event{Type: EventMemcachedThreads, Threads: threads})
+	// The new threads start with the affinity of the service manager.
+	if err := memcached.SetCpuAffinity(ctx, cli.MemcachedCpus()); err != nil {
+		return fmt.Errorf("pin memcached to cpu %v: %w", cli.MemcachedCpus(), err)
+	}
+	return nil
+}
+
+// The cpus of memcached: those reserved for it until it is pinned elsewhere.
+func (cli *Controller) MemcachedCpus() CpuList {
+	if cli.memcachedCpus == nil {
+		cli.memcachedCpus = append(CpuList(nil), cli.ReservedCpus()...)
+	}
+	return cli.memcachedCpus
+}
+
+func (cli *Controller) MemcachedHealth(ctx context.Context) error {
+	return cli.memcached().Health(ctx)
+}
+
+// Save the output and runtime description of every job in the result directory.
+// Failures on a single job are logged and skipped.
+func (cli *Controller) WriteLogs(ctx context.Context, resultDir string, jobs []JobInfo) error {
 	logPath := path.Join(resultDir, "logs")
 	if err := os.MkdirAll(logPath, 0755); err != nil {
-		log.Fatal(err)
+		return err
 	}
 	for _, job := range jobs {
 		id := job.Name
-		reader, err := cli.ContainerLogs(ctx, id, types.ContainerLogsOptions{
-			ShowStdout: true,
-			ShowStderr: true,
-		})
-		if err != nil {
-			log.Printf("Error getting logs for %v: %v", id, err)
-			continue
-		}
-
 		foutLog, err := os.Create(path.Join(logPath, id+".stdout"))
 		if err != nil {
 			log.Printf("Error creating stdout logs file for %v: %v", id, err)
@@ -162,8 +292,7 @@ func (cli *Controller) WriteLogs(ctx context.Context, resultDir string, jobs []J
 		}
 		defer ferrLog.Close()
 
-		_, err = stdcopy.StdCopy(foutLog, ferrLog, reader)
-		if err != nil && err != io.EOF {
+		if err := cli.Runtime.Logs(ctx, id, foutLog, ferrLog); err != nil {
 			log.Printf("Error writing container logs for %v: %v", id, err)
 			continue
 		}
@@ -171,11 +300,11 @@ func (cli *Controller) WriteLogs(ctx context.Context, resultDir string, jobs []J
 
 	infoPath := path.Join(resultDir, "info")
 	if err := os.MkdirAll(infoPath, 0755); err != nil {
-		log.Fatal(err)
+		return err
 	}
 	for _, job := range jobs {
 		id := job.Name
-		_, info, err := cli.ContainerInspectWithRaw(ctx, id, false)
+		info, err := cli.Runtime.Info(ctx, id)
 		if err != nil {
 			log.Printf("Error getting info for %v: %v", id, err)
 			continue
@@ -194,4 +323,5 @@ func (cli *Controller) WriteLogs(ctx context.Context, resultDir string, jobs []J
 			continue
 		}
 	}
+	return nil
 }
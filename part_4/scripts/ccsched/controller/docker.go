@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Runtime backed by the Docker Engine API.
+type DockerRuntime struct {
+	*client.Client
+
+	cgroups sync.Map // Cgroup directory of every started job, by name.
+}
+
+func NewDockerRuntime() (*DockerRuntime, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+	return &DockerRuntime{Client: cli}, nil
+}
+
+// Map Docker errors onto the controller's error kinds.
+func dockerError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case client.IsErrNotFound(err):
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	case errdefs.IsConflict(err):
+		return fmt.Errorf("%w: %v", ErrConflict, err)
+	case client.IsErrConnectionFailed(err), errdefs.IsUnavailable(err):
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return err
+}
+
+func (rt *DockerRuntime) Create(ctx context.Context, job *JobInfo) error {
+	w := job.Workload()
+
+	reader, err := rt.ImagePull(ctx, w.Image, types.ImagePullOptions{})
+	if err != nil {
+		return dockerError(err)
+	}
+	// The pull is only complete once the progress stream has been consumed.
+	_, err = io.Copy(ioutil.Discard, reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	_, err = rt.ContainerCreate(ctx, &container.Config{
+		Image:      w.Image,
+		Entrypoint: w.Command,
+		Cmd:        w.Args,
+		Env:        w.Env,
+		WorkingDir: w.WorkingDir,
+	}, nil, nil, nil, job.Name)
+	return dockerError(err)
+}
+
+func (rt *DockerRuntime) Start(ctx context.Context, id string) error {
+	return dockerError(rt.ContainerStart(ctx, id, types.ContainerStartOptions{}))
+}
+
+func (rt *DockerRuntime) Pause(ctx context.Context, id string) error {
+	return dockerError(rt.ContainerPause(ctx, id))
+}
+
+func (rt *DockerRuntime) Unpause(ctx context.Context, id string) error {
+	return dockerError(rt.ContainerUnpause(ctx, id))
+}
+
+func (rt *DockerRuntime) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	return dockerError(rt.ContainerStop(ctx, id, &timeout))
+}
+
+func (rt *DockerRuntime) Remove(ctx context.Context, id string) error {
+	rt.cgroups.Delete(id)
+	return dockerError(rt.ContainerRemove(ctx, id, types.ContainerRemoveOptions{Force: true}))
+}
+
+func (rt *DockerRuntime) SetCpuset(ctx context.Context, id string, cpuList CpuList) error {
+	_, err := rt.ContainerUpdate(ctx, id, container.UpdateConfig{
+		Resources: container.Resources{
+			CpusetCpus: cpuList.String(),
+		},
+	})
+	return dockerError(err)
+}
+
+func (rt *DockerRuntime) Inspect(ctx context.Context, id string) (JobStatus, error) {
+	res, err := rt.ContainerInspect(ctx, id)
+	if err != nil {
+		return JobStatus{}, dockerError(err)
+	}
+	status := JobStatus{State: JobState(res.State.Status), ExitCode: res.State.ExitCode}
+	if res.State.Status == "dead" {
+		status.State = StateExited
+	}
+	return status, nil
+}
+
+func (rt *DockerRuntime) Events(ctx context.Context) <-chan JobEvent {
+	msgs, errs := rt.Client.Events(ctx, types.EventsOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", events.ContainerEventType),
+			filters.Arg("event", "die"),
+			filters.Arg("event", "oom"),
+			filters.Arg("event", "pause"),
+			filters.Arg("event", "unpause"),
+		),
+	})
+
+	jobEvents := make(chan JobEvent)
+	go func() {
+		defer close(jobEvents)
+		for {
+			select {
+			case msg := <-msgs:
+				ev := JobEvent{
+					Job:  msg.Actor.Attributes["name"],
+					Time: time.Unix(0, msg.TimeNano),
+				}
+				switch msg.Action {
+				case "die":
+					ev.Type = JobExited
+					ev.ExitCode, _ = strconv.Atoi(msg.Actor.Attributes["exitCode"])
+				case "oom":
+					ev.Type = JobOOM
+				case "pause":
+					ev.Type = JobPaused
+				case "unpause":
+					ev.Type = JobUnpaused
+				default:
+					continue
+				}
+				select {
+				case jobEvents <- ev:
+				case <-ctx.Done():
+					return
+				}
+			case err := <-errs:
+				if ctx.Err() == nil {
+					log.Println("Error receiving docker events:", err)
+				}
+				return
+			}
+		}
+	}()
+	return jobEvents
+}
+
+func (rt *DockerRuntime) Logs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	reader, err := rt.ContainerLogs(ctx, id, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+	if err != nil {
+		return dockerError(err)
+	}
+	defer reader.Close()
+
+	_, err = stdcopy.StdCopy(stdout, stderr, reader)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func (rt *DockerRuntime) Info(ctx context.Context, id string) ([]byte, error) {
+	_, info, err := rt.ContainerInspectWithRaw(ctx, id, false)
+	return info, dockerError(err)
+}
+
+// Read the cpu time of the job from its cgroup, found through its main process once started.
+func (rt *DockerRuntime) CpuUsage(ctx context.Context, id string) (time.Duration, error) {
+	dir, ok := rt.cgroups.Load(id)
+	if !ok {
+		res, err := rt.ContainerInspect(ctx, id)
+		if err != nil {
+			return 0, dockerError(err)
+		}
+		if res.State.Pid == 0 {
+			return 0, fmt.Errorf("%w: %v is %v", ErrConflict, id, res.State.Status)
+		}
+		cgroup, err := ProcessCgroup(res.State.Pid)
+		if err != nil {
+			return 0, err
+		}
+		dir, _ = rt.cgroups.LoadOrStore(id, cgroup)
+	}
+	usage, err := CgroupCpuUsage(dir.(string))
+	if os.IsNotExist(err) {
+		// The cgroup goes away with the container.
+		return 0, fmt.Errorf("%w: %v", ErrAlreadyExited, err)
+	}
+	return usage, err
+}
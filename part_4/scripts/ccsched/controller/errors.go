@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Kinds of failures reported by the controller; test for them with errors.Is.
+var (
+	ErrNotFound      = errors.New("job not found")
+	ErrAlreadyExited = errors.New("job already exited")
+	ErrConflict      = errors.New("job is in a conflicting state")
+	ErrUnavailable   = errors.New("runtime unavailable")
+	ErrNoProcess     = errors.New("process not found")
+)
+
+// JobError records a failed operation on a job.
+type JobError struct {
+	Op  string // e.g. "pause"
+	Job string
+	Err error
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("%v job %v: %v", e.Op, e.Job, e.Err)
+}
+
+func (e *JobError) Unwrap() error { return e.Err }
+
+// Wrap a runtime error of an operation on a job. A conflict on a job that has
+// exited in the meantime is reported as ErrAlreadyExited.
+func (cli *Controller) jobError(ctx context.Context, op, id string, err error) error {
+	if errors.Is(err, ErrConflict) {
+		if status, serr := cli.Runtime.Inspect(ctx, id); serr == nil && status.State == StateExited {
+			err = fmt.Errorf("%w: %v", ErrAlreadyExited, err)
+		}
+	}
+	return &JobError{Op: op, Job: id, Err: err}
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// A past run of a job that completed successfully, for the EtaModel to learn from.
+type JobRun struct {
+	Job     string
+	Threads int
+	Work    time.Duration // Running time weighted by the cores the threads could use.
+}
+
+// Progress of a job in the current run.
+type jobProgress struct {
+	threads int
+	work    time.Duration // Expected work, in core time the threads can use.
+	done    time.Duration
+	cores   int       // Cpus of the job.
+	since   time.Time // Start of the current running period, zero while not running.
+}
+
+// The cores the threads of a job can use.
+func (p *jobProgress) parallelism() int {
+	if p.cores == 0 || p.cores > p.threads {
+		return p.threads
+	}
+	return p.cores
+}
+
+// Account the progress made since the last update.
+func (p *jobProgress) update(now time.Time) {
+	if p.since.IsZero() {
+		return
+	}
+	elapsed := now.Sub(p.since)
+	p.done += elapsed * time.Duration(p.parallelism())
+	p.since = now
+}
+
+// EtaModel learns the work of every job from its past runs, as recorded in the history
+// of the runs. A job needs the same work on any number of cores, up to its thread count,
+// so that its run time scales with the cores it is granted and stops while it is paused.
+type EtaModel struct {
+	mu       sync.Mutex
+	runs     []JobRun
+	progress map[string]*jobProgress
+}
+
+// Create a model that learns from the given past runs of the jobs.
+func NewEtaModel(runs []JobRun) *EtaModel {
+	return &EtaModel{runs: runs}
+}
+
+// The work of a job learned from the runs with the same thread count, if any.
+func (m *EtaModel) learnedWork(name string, threads int) (time.Duration, bool) {
+	var sum time.Duration
+	n := 0
+	for _, run := range m.runs {
+		if run.Job == name && run.Threads == threads {
+			sum += run.Work
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / time.Duration(n), true
+}
+
+// Seed the ETA of a new job from its past runs, or take its manifest ETA as its run time
+// on as many cores as threads.
+func (m *EtaModel) created(job *JobInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := &jobProgress{threads: job.Threads}
+	if p.threads < 1 {
+		p.threads = 1
+	}
+	if work, ok := m.learnedWork(job.Name, job.Threads); ok {
+		p.work = work
+		job.Eta = work / time.Duration(p.threads)
+	} else {
+		p.work = job.Eta * time.Duration(p.threads)
+	}
+	if m.progress == nil {
+		m.progress = make(map[string]*jobProgress)
+	}
+	m.progress[job.Name] = p
+}
+
+// Follow the progress of the jobs through the recorded events. The work of the completed
+// ones is recorded with the summary of the run, see JobSummary.Work.
+func (m *EtaModel) record(now time.Time, ev Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.progress[ev.Job]
+	if !ok {
+		return
+	}
+	switch ev.Type {
+	case EventJobStarted, EventJobUnpaused:
+		p.since = now
+	case EventJobCpuset:
+		p.update(now)
+		p.cores = len(ev.Cpuset)
+	case EventJobPaused:
+		p.update(now)
+		p.since = time.Time{}
+	case EventJobCompleted, EventJobStopped:
+		delete(m.progress, ev.Job)
+	}
+}
+
+// Time left for a job on the cores it was last granted, or on as many as its threads.
+// A job that runs longer than expected is assumed to need another tenth of what it has done.
+func (m *EtaModel) eta(now time.Time, job *JobInfo) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.progress[job.Name]
+	if !ok {
+		return job.Eta
+	}
+	p.update(now)
+	if p.done >= p.work && p.done > 0 {
+		log.Println("ETA underestimated for job", job.Name)
+		p.work = p.done + p.done/10
+	}
+	return (p.work - p.done) / time.Duration(p.parallelism())
+}
+
+func (cli *Controller) etaModel() *EtaModel {
+	if cli.Eta == nil {
+		cli.Eta = &EtaModel{}
+	}
+	return cli.Eta
+}
+
+// Update the ETA of a job from its progress so far.
+func (cli *Controller) UpdateEta(job *JobInfo) {
+	job.Eta = cli.etaModel().eta(cli.Now(), job)
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// Types of the records in the event log. New types may be added, existing ones keep their meaning.
+const (
+	EventJobCreated       = "job_created"
+	EventJobStarted       = "job_started"
+	EventJobPaused        = "job_paused"
+	EventJobUnpaused      = "job_unpaused"
+	EventJobStopped       = "job_stopped"
+	EventJobCompleted     = "job_completed"
+	EventJobSkipped       = "job_skipped"
+	EventJobCpuset        = "job_cpuset"
+	EventMemcachedCpus    = "memcached_cpuset"
+	EventMemcachedThreads = "memcached_threads"
+	EventCpuSample        = "cpu_sample"
+	EventLatency          = "latency_sample"
+)
+
+// A record of the event log. The JSON field names form a stable schema for analysis scripts:
+// fields are only ever added, never renamed or removed.
+type Event struct {
+	TimestampMs    int64              `json:"ts_ms"` // Unix time in milliseconds.
+	Type           string             `json:"type"`
+	Job            string             `json:"job,omitempty"`
+	Cpuset         CpuList            `json:"cpuset,omitempty"`          // Cpus of the job.
+	MemcachedCores CpuList            `json:"memcached_cores,omitempty"` // Cpus of memcached at the time of the event.
+	CpuUsage       []float64          `json:"cpu_usage,omitempty"`       // Utilization per cpu, for cpu_sample.
+	JobCpu         map[string]float64 `json:"job_cpu,omitempty"`         // Utilization per job in percent of a cpu, for cpu_sample.
+	ServiceCpu     map[string]float64 `json:"service_cpu,omitempty"`     // Utilization of memcached in percent of a cpu, for cpu_sample.
+	Pressure       *PressureSample    `json:"pressure,omitempty"`        // Stalls over the interval, for cpu_sample.
+	LatencyP50Us   float64            `json:"latency_p50_us,omitempty"`  // Latency percentiles of memcached, for latency_sample.
+	LatencyP95Us   float64            `json:"latency_p95_us,omitempty"`
+	LatencyP99Us   float64            `json:"latency_p99_us,omitempty"`
+	Threads        int                `json:"threads,omitempty"` // Threads of the job for job_created, worker threads of memcached for memcached_threads.
+	ExitCode       int                `json:"exit_code,omitempty"`
+	Reason         string             `json:"reason,omitempty"`
+}
+
+// EventLog writes events as JSON lines, one object per line.
+type EventLog struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func NewEventLog(w io.Writer) *EventLog {
+	return &EventLog{w: w, enc: json.NewEncoder(w)}
+}
+
+// Create an event log file, appending to it if it already exists.
+func OpenEventLog(file string) (*EventLog, error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return NewEventLog(f), nil
+}
+
+func (l *EventLog) Write(ev Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(ev)
+}
+
+func (l *EventLog) Close() error {
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Reason of the cleanup at the end of a run, such as giving memcached back its cpus.
+const ReasonShutdown = "shutdown"
+
+type reasonKey struct{}
+
+// Attach the reason of a scheduling decision to the events recorded with ctx.
+func WithReason(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, reasonKey{}, reason)
+}
+
+func reasonOf(ctx context.Context) string {
+	reason, _ := ctx.Value(reasonKey{}).(string)
+	return reason
+}
+
+// Record an event, filling in the time and the cpus of memcached.
+// Events also feed the summary of the run.
+func (cli *Controller) RecordEvent(ctx context.Context, ev Event) {
+	now := cli.Now()
+	ev.TimestampMs = now.UnixNano() / 1e6
+	ev.MemcachedCores = cli.MemcachedCpus()
+	if ev.Reason == "" {
+		ev.Reason = reasonOf(ctx)
+	}
+	cli.stats.record(now, ev, cli.LatencySLO(), cli.ReservedCpus())
+	cli.etaModel().record(now, ev)
+	if cli.EventLog == nil {
+		return
+	}
+	if err := cli.EventLog.Write(ev); err != nil {
+		cli.EventLog = nil
+		log.Println("Error writing event log, disabling it:", err)
+	}
+}
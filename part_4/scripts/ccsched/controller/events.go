@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"context"
+	"time"
+)
+
+type JobEventType string
+
+const (
+	JobExited   JobEventType = "exited"
+	JobOOM      JobEventType = "oom"
+	JobPaused   JobEventType = "paused"
+	JobUnpaused JobEventType = "unpaused"
+)
+
+// A change in the state of a job, as reported by the runtime.
+type JobEvent struct {
+	Type     JobEventType
+	Job      string
+	ExitCode int // Only set for JobExited.
+	Time     time.Time
+}
+
+// Subscribe to the events of all jobs. The channel is closed when the runtime's
+// stream fails, after which the caller has to poll JobStatus instead.
+func (cli *Controller) JobEvents(ctx context.Context) <-chan JobEvent {
+	return cli.Runtime.Events(ctx)
+}
+
+// A sample of the cpus. Jobs and Services attribute the load, when the runtime and
+// memcached account their cpu time. Pressure tells how much tasks waited for the cpus.
+type CpuSample struct {
+	Usage    []float64          // Utilization of every cpu in percent.
+	Jobs     map[string]float64 // Utilization of every running job, in percent of a cpu.
+	Services map[string]float64 // Utilization of memcached, in percent of a cpu.
+	Pressure *PressureSample    // Stalls over the interval, if measured.
+	Err      error
+}
+
+// CpuTicker samples the cpus in the background, so that a scheduler can wait for
+// the next sample and for job events at the same time. A new sample is only taken
+// once the previous one has been handled, as announced by Next.
+type CpuTicker struct {
+	C    <-chan CpuSample
+	next chan struct{}
+}
+
+// Start sampling the cpus over the given interval until ctx is done.
+func (cli *Controller) NewCpuTicker(ctx context.Context, interval time.Duration) *CpuTicker {
+	c := make(chan CpuSample)
+	t := &CpuTicker{C: c, next: make(chan struct{}, 1)}
+	t.Next()
+	go func() {
+		for {
+			select {
+			case <-t.next:
+			case <-ctx.Done():
+				return
+			}
+			sample := CpuSample{}
+			sample.Usage, sample.Err = cli.CpuPercent(interval)
+			if sample.Err == nil {
+				sample.Jobs, sample.Services = cli.cpuAccounting(ctx)
+				sample.Pressure = cli.pressure()
+			}
+			select {
+			case c <- sample:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// Request the next sample.
+func (t *CpuTicker) Next() {
+	select {
+	case t.next <- struct{}{}:
+	default:
+	}
+}
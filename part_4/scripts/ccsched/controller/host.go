@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+)
+
+// Source of the current time, so that runs can be driven by a simulated clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// Samples the utilization (in percent) of every cpu over an interval.
+type CpuSampler interface {
+	Percent(interval time.Duration) ([]float64, error)
+}
+
+// Samples the host cpus, blocking for the whole interval.
+type hostSampler struct{}
+
+func (hostSampler) Percent(interval time.Duration) ([]float64, error) {
+	return cpu.Percent(interval, true)
+}
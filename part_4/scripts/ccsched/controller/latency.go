@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Latency target of memcached: the 95th percentile of its requests must stay below it.
+const DefaultSLO = time.Millisecond
+
+// The latency source has not measured anything yet.
+var ErrNoLatency = errors.New("no latency measured yet")
+
+// Percentiles of the latency of memcached requests.
+type LatencyStats struct {
+	P50, P95, P99 time.Duration
+}
+
+// Measures the latency of memcached as seen by its clients.
+type LatencySource interface {
+	// The latency percentiles of the most recent requests.
+	Percentiles() (LatencyStats, error)
+}
+
+// The latency target of memcached.
+func (cli *Controller) LatencySLO() time.Duration {
+	if cli.SLO == 0 {
+		return DefaultSLO
+	}
+	return cli.SLO
+}
+
+// Measure the latency of memcached and record it.
+func (cli *Controller) MemcachedLatency(ctx context.Context) (LatencyStats, error) {
+	stats, err := cli.Latency.Percentiles()
+	if err != nil {
+		return LatencyStats{}, err
+	}
+	cli.RecordEvent(ctx, Event{
+		Type:         EventLatency,
+		LatencyP50Us: microseconds(stats.P50),
+		LatencyP95Us: microseconds(stats.P95),
+		LatencyP99Us: microseconds(stats.P99),
+	})
+	return stats, nil
+}
+
+func microseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
+
+// McperfLog follows the output of mcperf while it is being written and reports the
+// latency of the last completed interval.
+type McperfLog struct {
+	f       *os.File
+	r       *bufio.Reader
+	partial string         // Incomplete last line.
+	cols    map[string]int // Column of each percentile.
+	stats   LatencyStats
+	seen    bool
+}
+
+func OpenMcperfLog(file string) (*McperfLog, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	// Columns of the default mcperf report, in case the header has already gone by.
+	cols := map[string]int{"p50": 6, "p95": 12, "p99": 13}
+	return &McperfLog{f: f, r: bufio.NewReader(f), cols: cols}, nil
+}
+
+func (m *McperfLog) Percentiles() (LatencyStats, error) {
+	for {
+		line, err := m.r.ReadString('\n')
+		if err == io.EOF {
+			// mcperf is still writing, pick up the rest of the line next time.
+			m.partial += line
+			break
+		} else if err != nil {
+			return LatencyStats{}, err
+		}
+		m.parseLine(m.partial + line)
+		m.partial = ""
+	}
+	if !m.seen {
+		return LatencyStats{}, ErrNoLatency
+	}
+	return m.stats, nil
+}
+
+func (m *McperfLog) parseLine(line string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+	switch fields[0] {
+	case "#type":
+		for i, name := range fields {
+			if _, ok := m.cols[name]; ok {
+				m.cols[name] = i
+			}
+		}
+	case "read":
+		var stats LatencyStats
+		for name, p := range map[string]*time.Duration{"p50": &stats.P50, "p95": &stats.P95, "p99": &stats.P99} {
+			col := m.cols[name]
+			if col >= len(fields) {
+				return
+			}
+			us, err := strconv.ParseFloat(fields[col], 64)
+			if err != nil {
+				return
+			}
+			*p = time.Duration(us * float64(time.Microsecond))
+		}
+		m.stats = stats
+		m.seen = true
+	}
+}
+
+func (m *McperfLog) Close() error {
+	return m.f.Close()
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// A job as described in a manifest file, e.g.
+//
+//	{"jobs": [
+//	  {"name": "ferret", "threads": 2, "eta": "400s"},
+//	  {"name": "splash2x-fft", "threads": 2, "eta": "120s", "batch_only": true},
+//	  {"name": "xz", "image": "alpine", "command": ["sh", "-c"],
+//	   "args": ["xz -T $CCSCHED_THREADS -9 < /dev/urandom | head -c 1G > /dev/null"]}
+//	]}
+type jobSpec struct {
+	Name         string            `json:"name"`
+	Image        string            `json:"image,omitempty"`
+	Command      []string          `json:"command,omitempty"`
+	Args         []string          `json:"args,omitempty"`
+	Env          map[string]string `json:"env,omitempty"`
+	WorkingDir   string            `json:"workdir,omitempty"`
+	Threads      int               `json:"threads"`
+	Eta          string            `json:"eta,omitempty"`
+	Priority     int               `json:"priority,omitempty"`
+	Dependencies []string          `json:"dependencies,omitempty"`
+	BatchOnly    bool              `json:"batch_only,omitempty"`
+}
+
+type manifest struct {
+	Jobs []jobSpec `json:"jobs"`
+}
+
+// Load the jobs listed in a JSON manifest file.
+func LoadJobManifest(file string) ([]JobInfo, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	jobs, err := ParseJobManifest(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", file, err)
+	}
+	return jobs, nil
+}
+
+// Parse and validate a JSON job manifest, keeping the order of the jobs.
+func ParseJobManifest(r io.Reader) ([]JobInfo, error) {
+	var m manifest
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	if len(m.Jobs) == 0 {
+		return nil, fmt.Errorf("manifest has no jobs")
+	}
+
+	names := make(map[string]bool)
+	jobs := make([]JobInfo, 0, len(m.Jobs))
+	for _, spec := range m.Jobs {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("job without a name")
+		}
+		if names[spec.Name] {
+			return nil, fmt.Errorf("job %v listed twice", spec.Name)
+		}
+		names[spec.Name] = true
+		if spec.Threads < 1 {
+			return nil, fmt.Errorf("job %v: threads must be at least 1", spec.Name)
+		}
+
+		job := JobInfo{
+			Name:         spec.Name,
+			Image:        spec.Image,
+			Command:      spec.Command,
+			Args:         spec.Args,
+			Env:          spec.Env,
+			WorkingDir:   spec.WorkingDir,
+			Threads:      spec.Threads,
+			Priority:     spec.Priority,
+			Dependencies: spec.Dependencies,
+			BatchOnly:    spec.BatchOnly,
+		}
+		if spec.Eta != "" {
+			eta, err := time.ParseDuration(spec.Eta)
+			if err != nil {
+				return nil, fmt.Errorf("job %v: %w", spec.Name, err)
+			}
+			job.Eta = eta
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := CheckDependencies(jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Check that the jobs only depend on each other, and not in a cycle.
+func CheckDependencies(jobs []JobInfo) error {
+	deps := make(map[string][]string, len(jobs))
+	for _, job := range jobs {
+		deps[job.Name] = job.Dependencies
+	}
+	for _, job := range jobs {
+		for _, dep := range job.Dependencies {
+			if _, ok := deps[dep]; !ok {
+				return fmt.Errorf("job %v depends on unknown job %v", job.Name, dep)
+			}
+		}
+	}
+
+	// Depth-first search, a job met again while its dependencies are visited closes a cycle.
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(jobs))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			for i, job := range path {
+				if job == name {
+					return fmt.Errorf("dependency cycle: %v -> %v", strings.Join(path[i:], " -> "), name)
+				}
+			}
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, job := range jobs {
+		if err := visit(job.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
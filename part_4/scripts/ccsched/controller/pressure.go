@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cumulative stall time of a resource from Pressure Stall Information (PSI).
+type PressureTotals struct {
+	Some time.Duration // Time at least one task was stalled.
+	Full time.Duration // Time all non-idle tasks were stalled at once. Always 0 for the cpu of the host.
+}
+
+// Read the totals of a PSI file, e.g. /proc/pressure/cpu or the cpu.pressure of a cgroup.
+func ReadPressure(file string) (PressureTotals, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return PressureTotals{}, err
+	}
+	defer f.Close()
+
+	// Lines are "some|full avg10=0.00 avg60=0.00 avg300=0.00 total=<us>".
+	var totals PressureTotals
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "total=") {
+				continue
+			}
+			us, err := strconv.ParseInt(strings.TrimPrefix(field, "total="), 10, 64)
+			if err != nil {
+				return PressureTotals{}, fmt.Errorf("%v: %w", file, err)
+			}
+			switch fields[0] {
+			case "some":
+				totals.Some = time.Duration(us) * time.Microsecond
+			case "full":
+				totals.Full = time.Duration(us) * time.Microsecond
+			}
+		}
+	}
+	return totals, scanner.Err()
+}
+
+// Share of time stalled on a resource over a sampling interval.
+type Pressure struct {
+	Some float64 `json:"some_pct"` // Percent of time at least one task was stalled.
+	Full float64 `json:"full_pct"` // Percent of time all non-idle tasks were stalled.
+}
+
+type PressureSample struct {
+	Cpu       Pressure `json:"cpu"`
+	Memory    Pressure `json:"memory"`
+	Io        Pressure `json:"io"`
+	Memcached Pressure `json:"memcached_cpu"` // Cpu pressure of the cgroup of memcached, that of the host if unknown.
+}
+
+// Measures how much the tasks of the host, and memcached, are stalled.
+type PressureSource interface {
+	// Stalls since the previous call. Fails with ErrNoPressure on the first one.
+	Pressure() (PressureSample, error)
+}
+
+// Nothing to compare the stall times to yet.
+var ErrNoPressure = errors.New("no pressure measured yet")
+
+// PressureSampler reads the PSI files of the host, and the cpu.pressure of the cgroup of
+// memcached under cgroup v2, and turns their totals into stall percentages.
+type PressureSampler struct {
+	Dir    string // Directory of the host files, /proc/pressure by default.
+	Cgroup string // Cgroup directory of memcached, if known.
+
+	mu   sync.Mutex
+	at   time.Time
+	last map[string]PressureTotals // By file.
+}
+
+func (p *PressureSampler) files() (cpu, memory, io, memcached string) {
+	dir := p.Dir
+	if dir == "" {
+		dir = "/proc/pressure"
+	}
+	cpu = path.Join(dir, "cpu")
+	memcached = cpu
+	if p.Cgroup != "" {
+		memcached = path.Join(p.Cgroup, "cpu.pressure")
+	}
+	return cpu, path.Join(dir, "memory"), path.Join(dir, "io"), memcached
+}
+
+func (p *PressureSampler) Pressure() (PressureSample, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(p.at)
+	first := p.last == nil
+	cpu, memory, io, memcached := p.files()
+	totals := make(map[string]PressureTotals)
+	for _, file := range []string{cpu, memory, io, memcached} {
+		t, err := ReadPressure(file)
+		if err != nil {
+			return PressureSample{}, err
+		}
+		totals[file] = t
+	}
+	prev := p.last
+	p.at, p.last = now, totals
+	if first || elapsed <= 0 {
+		return PressureSample{}, ErrNoPressure
+	}
+
+	percent := func(file string) Pressure {
+		return Pressure{
+			Some: 100 * float64(totals[file].Some-prev[file].Some) / float64(elapsed),
+			Full: 100 * float64(totals[file].Full-prev[file].Full) / float64(elapsed),
+		}
+	}
+	return PressureSample{
+		Cpu:       percent(cpu),
+		Memory:    percent(memory),
+		Io:        percent(io),
+		Memcached: percent(memcached),
+	}, nil
+}
+
+// Sample the pressure if there is a source. Failures are logged once, and leave the sample nil.
+func (cli *Controller) pressure() *PressureSample {
+	if cli.Pressure == nil {
+		return nil
+	}
+	sample, err := cli.Pressure.Pressure()
+	if err != nil {
+		failing := !errors.Is(err, ErrNoPressure)
+		if failing && !cli.pressureFailing {
+			log.Println("Error measuring pressure stalls:", err)
+		}
+		cli.pressureFailing = failing
+		return nil
+	}
+	cli.pressureFailing = false
+	return &sample
+}
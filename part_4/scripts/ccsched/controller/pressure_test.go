@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestPressureSamplerStart(t *testing.T) {
+	// A host without PSI fails the first sample, one with it only sets the baseline.
+	dir := t.TempDir()
+	psi := &PressureSampler{Dir: dir}
+	if _, err := psi.Pressure(); err == nil || errors.Is(err, ErrNoPressure) {
+		t.Errorf("first sample without PSI files: %v, want a read error", err)
+	}
+
+	for _, name := range []string{"cpu", "memory", "io"} {
+		data := "some avg10=0.00 avg60=0.00 avg300=0.00 total=100\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=50\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := psi.Pressure(); !errors.Is(err, ErrNoPressure) {
+		t.Errorf("first sample: %v, want %v", err, ErrNoPressure)
+	}
+	if _, err := psi.Pressure(); err != nil {
+		t.Errorf("second sample: %v", err)
+	}
+}
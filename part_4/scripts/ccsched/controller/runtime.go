@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// State of a job as reported by the runtime.
+type JobState string
+
+const (
+	StateCreated JobState = "created"
+	StateRunning JobState = "running"
+	StatePaused  JobState = "paused"
+	StateExited  JobState = "exited"
+)
+
+type JobStatus struct {
+	State    JobState
+	ExitCode int // Only meaningful once the job has exited.
+}
+
+// A Runtime is the backend that actually runs the jobs (e.g. Docker, containerd or a fake).
+// Jobs are identified by their name.
+type Runtime interface {
+	// Create a job without starting it.
+	Create(ctx context.Context, job *JobInfo) error
+
+	Start(ctx context.Context, id string) error
+	Pause(ctx context.Context, id string) error
+	Unpause(ctx context.Context, id string) error
+
+	// Stop a running job, killing it if it does not exit within the timeout.
+	Stop(ctx context.Context, id string, timeout time.Duration) error
+
+	// Stop and remove a job, regardless of its state.
+	Remove(ctx context.Context, id string) error
+
+	// Restrict the job to run on the given cpus.
+	SetCpuset(ctx context.Context, id string, cpuList CpuList) error
+
+	Inspect(ctx context.Context, id string) (JobStatus, error)
+
+	// Stream the events of all jobs until ctx is done. The channel is closed if the stream fails.
+	Events(ctx context.Context) <-chan JobEvent
+
+	// Copy the output of the job to stdout and stderr.
+	Logs(ctx context.Context, id string, stdout, stderr io.Writer) error
+
+	// Raw runtime-specific description of the job, stored alongside the logs.
+	Info(ctx context.Context, id string) ([]byte, error)
+}
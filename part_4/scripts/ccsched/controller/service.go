@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The service does not support the operation.
+var ErrNotSupported = errors.New("operation not supported")
+
+// A Service is a latency-critical process colocated with the jobs, such as memcached.
+type Service interface {
+	// Restrict the service to run on the given cpus.
+	SetCpuAffinity(ctx context.Context, cpuList CpuList) error
+
+	// Change the number of worker threads, restarting the service if needed.
+	SetThreads(ctx context.Context, threads int) error
+
+	Restart(ctx context.Context) error
+
+	// Check that the service is up and serving requests.
+	Health(ctx context.Context) error
+}
+
+// MemcachedService is memcached installed on the host and managed by systemd, as set up
+// by cluster_deploy.sh.
+type MemcachedService struct {
+	Process    ProcessPinner // Found by the name memcached if nothing else is set.
+	Unit       string        // Systemd unit, memcached by default.
+	ConfigFile string        // Configuration holding the -t option, /etc/memcached.conf by default.
+	Addr       string        // host:port to check the health of memcached on, if set.
+
+	mu     sync.Mutex
+	cgroup string // Found once, and again only after reading from it fails.
+}
+
+func (m *MemcachedService) process() *ProcessPinner {
+	p := m.Process
+	if p.Name == "" {
+		p.Name = "memcached"
+	}
+	return &p
+}
+
+func (m *MemcachedService) SetCpuAffinity(ctx context.Context, cpuList CpuList) error {
+	return m.process().SetCpuAffinity(cpuList)
+}
+
+// The cgroup of memcached: Process.Cgroup if set, the cgroup of its process otherwise,
+// which is memcached.service under systemd.
+func (m *MemcachedService) Cgroup() (string, error) {
+	p := m.process()
+	if p.Cgroup != "" {
+		return p.Cgroup, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cgroup != "" {
+		return m.cgroup, nil
+	}
+	pids, err := p.pids()
+	if err != nil {
+		return "", err
+	}
+	cgroup, err := ProcessCgroup(pids[0])
+	if err != nil {
+		return "", err
+	}
+	m.cgroup = cgroup
+	return cgroup, nil
+}
+
+// Read the cpu time of memcached from its cgroup. The cgroup is looked up again if it
+// cannot be read, in case memcached has moved since.
+func (m *MemcachedService) CpuUsage(ctx context.Context) (time.Duration, error) {
+	cgroup, err := m.Cgroup()
+	if err != nil {
+		return 0, err
+	}
+	usage, err := CgroupCpuUsage(cgroup)
+	if err == nil || m.Process.Cgroup != "" {
+		return usage, err
+	}
+	m.mu.Lock()
+	if m.cgroup == cgroup {
+		m.cgroup = ""
+	}
+	m.mu.Unlock()
+	if cgroup, err = m.Cgroup(); err != nil {
+		return 0, err
+	}
+	return CgroupCpuUsage(cgroup)
+}
+
+var threadsOption = regexp.MustCompile(`(?m)^-t\s+\d+\s*$`)
+
+// Rewrite the -t option of the configuration and restart memcached.
+func (m *MemcachedService) SetThreads(ctx context.Context, threads int) error {
+	file := m.ConfigFile
+	if file == "" {
+		file = "/etc/memcached.conf"
+	}
+	conf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	option := fmt.Sprintf("-t %v", threads)
+	if threadsOption.Match(conf) {
+		conf = threadsOption.ReplaceAll(conf, []byte(option))
+	} else {
+		conf = append(conf, []byte(option+"\n")...)
+	}
+	if err := ioutil.WriteFile(file, conf, 0644); err != nil {
+		return err
+	}
+	return m.Restart(ctx)
+}
+
+func (m *MemcachedService) Restart(ctx context.Context) error {
+	unit := m.Unit
+	if unit == "" {
+		unit = "memcached"
+	}
+	out, err := exec.CommandContext(ctx, "systemctl", "restart", unit).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("restart %v: %v: %s", unit, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Check that the process runs and, if Addr is set, answers a version request.
+func (m *MemcachedService) Health(ctx context.Context) error {
+	if _, err := m.process().pids(); err != nil {
+		return err
+	}
+	if m.Addr == "" {
+		return nil
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", m.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(time.Second)); err != nil {
+		return err
+	}
+	if _, err := conn.Write([]byte("version\r\n")); err != nil {
+		return err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(reply, "VERSION") {
+		return fmt.Errorf("memcached at %v: unexpected reply %q", m.Addr, strings.TrimSpace(reply))
+	}
+	return nil
+}
+
+// ContainerService is a latency-critical service running in a container of the runtime.
+type ContainerService struct {
+	Runtime Runtime
+	ID      string
+}
+
+func (c *ContainerService) SetCpuAffinity(ctx context.Context, cpuList CpuList) error {
+	return c.Runtime.SetCpuset(ctx, c.ID, cpuList)
+}
+
+// The threads of a container are fixed by its image and command.
+func (c *ContainerService) SetThreads(ctx context.Context, threads int) error {
+	return fmt.Errorf("set threads of %v: %w", c.ID, ErrNotSupported)
+}
+
+func (c *ContainerService) Restart(ctx context.Context) error {
+	if err := c.Runtime.Stop(ctx, c.ID, stopTimeout); err != nil {
+		return err
+	}
+	return c.Runtime.Start(ctx, c.ID)
+}
+
+func (c *ContainerService) CpuUsage(ctx context.Context) (time.Duration, error) {
+	rt, ok := c.Runtime.(CpuAccountingRuntime)
+	if !ok {
+		return 0, fmt.Errorf("cpu usage of %v: %w", c.ID, ErrNotSupported)
+	}
+	return rt.CpuUsage(ctx, c.ID)
+}
+
+func (c *ContainerService) Health(ctx context.Context) error {
+	status, err := c.Runtime.Inspect(ctx, c.ID)
+	if err != nil {
+		return err
+	}
+	if status.State != StateRunning {
+		return fmt.Errorf("container %v is %v", c.ID, status.State)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestMemcachedCgroup(t *testing.T) {
+	// Stand in for memcached, found through a pidfile.
+	pidfile := filepath.Join(t.TempDir(), "memcached.pid")
+	writePid := func() {
+		if err := ioutil.WriteFile(pidfile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writePid()
+	want, err := ProcessCgroup(os.Getpid())
+	if err != nil {
+		t.Skip("no cgroup for the test process:", err)
+	}
+
+	m := &MemcachedService{Process: ProcessPinner{Pidfile: pidfile}}
+	if got, err := m.Cgroup(); err != nil || got != want {
+		t.Fatalf("cgroup %q, %v, want %q", got, err, want)
+	}
+	// Found once, the cgroup is not looked up again.
+	if err := os.Remove(pidfile); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := m.Cgroup(); err != nil || got != want {
+		t.Errorf("cached cgroup %q, %v, want %q", got, err, want)
+	}
+
+	// Until it cannot be read.
+	m.cgroup = filepath.Join(t.TempDir(), "gone")
+	if _, err := m.CpuUsage(context.Background()); err == nil {
+		t.Errorf("read a cgroup that is gone with memcached not running")
+	}
+	writePid()
+	if _, err := CgroupCpuUsage(want); err != nil {
+		t.Skip("cannot read the cgroup of the test process:", err)
+	}
+	if _, err := m.CpuUsage(context.Background()); err != nil {
+		t.Errorf("cpu usage after memcached came back: %v", err)
+	}
+	if got, err := m.Cgroup(); err != nil || got != want {
+		t.Errorf("cgroup found again %q, %v, want %q", got, err, want)
+	}
+}
@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// What happened to a job during a run.
+type JobSummary struct {
+	Name      string    `json:"name"`
+	Threads   int       `json:"threads"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	WallTime  float64   `json:"wall_time_s"`   // From start to exit.
+	PauseTime float64   `json:"paused_time_s"` // Part of the wall time spent paused.
+	CoreTime  float64   `json:"core_time_s"`   // Cpus held while running, times the time held.
+	Work      float64   `json:"work_core_s"`   // Like CoreTime, counting no more cpus than threads.
+	Cores     float64   `json:"avg_cores"`     // Cpus held on average while running.
+	Pauses    int       `json:"pauses"`
+	Unpauses  int       `json:"unpauses"`
+	Completed bool      `json:"completed"` // False if the job was stopped, failed or never finished.
+}
+
+type Summary struct {
+	Makespan          float64      `json:"makespan_s"` // From the first job start to the last job exit.
+	MemcachedSwitches int          `json:"memcached_core_switches"`
+	LatencySamples    int          `json:"latency_samples"`
+	SLOViolations     int          `json:"memcached_slo_violations"` // Latency samples with a p95 above the SLO.
+	Jobs              []JobSummary `json:"jobs"`
+}
+
+type jobStats struct {
+	threads                     int
+	started, finished, pausedAt time.Time
+	paused                      time.Duration
+	cpus                        int       // Cpus of the job.
+	heldSince                   time.Time // Since when the job runs on its cpus, zero while not running.
+	coreTime, work              time.Duration
+	pauses, unpauses            int
+	completed                   bool
+}
+
+// Account the cpus held by a running job up to now.
+func (js *jobStats) hold(now time.Time) {
+	if !js.heldSince.IsZero() {
+		held := now.Sub(js.heldSince)
+		js.coreTime += held * time.Duration(js.cpus)
+		js.work += held * time.Duration(js.parallelism())
+		js.heldSince = now
+	}
+}
+
+// The cpus the threads of the job can use, all of its threads if it was never pinned.
+func (js *jobStats) parallelism() int {
+	threads := js.threads
+	if threads < 1 {
+		threads = 1
+	}
+	if js.cpus == 0 || js.cpus > threads {
+		return threads
+	}
+	return js.cpus
+}
+
+// Bookkeeping of the recorded events for the summary of the run.
+type runStats struct {
+	mu                sync.Mutex
+	jobs              map[string]*jobStats
+	memcachedCpus     CpuList
+	memcachedSwitches int
+	latencySamples    int
+	sloViolations     int
+}
+
+func (st *runStats) job(id string) *jobStats {
+	if st.jobs == nil {
+		st.jobs = make(map[string]*jobStats)
+	}
+	js, ok := st.jobs[id]
+	if !ok {
+		js = &jobStats{}
+		st.jobs[id] = js
+	}
+	return js
+}
+
+// Record an event. slo is the latency target of memcached, which starts out on the
+// reserved cpus.
+func (st *runStats) record(now time.Time, ev Event, slo time.Duration, reserved CpuList) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	switch ev.Type {
+	case EventJobCreated:
+		st.job(ev.Job).threads = ev.Threads
+	case EventJobStarted:
+		js := st.job(ev.Job)
+		js.started = now
+		js.heldSince = now
+	case EventJobCpuset:
+		js := st.job(ev.Job)
+		js.hold(now)
+		js.cpus = len(ev.Cpuset)
+	case EventJobPaused:
+		js := st.job(ev.Job)
+		js.hold(now)
+		js.heldSince = time.Time{}
+		js.pausedAt = now
+		js.pauses++
+	case EventJobUnpaused:
+		js := st.job(ev.Job)
+		js.paused += now.Sub(js.pausedAt)
+		js.pausedAt = time.Time{}
+		js.heldSince = now
+		js.unpauses++
+	case EventJobCompleted, EventJobStopped:
+		js := st.job(ev.Job)
+		if !js.finished.IsZero() {
+			break
+		}
+		js.hold(now)
+		js.heldSince = time.Time{}
+		if !js.pausedAt.IsZero() {
+			js.paused += now.Sub(js.pausedAt)
+			js.pausedAt = time.Time{}
+		}
+		js.finished = now
+		js.completed = ev.Type == EventJobCompleted && ev.ExitCode == 0
+	case EventMemcachedCpus:
+		// Giving memcached back its cpus at shutdown is no scheduling decision.
+		if ev.Reason == ReasonShutdown {
+			break
+		}
+		if st.memcachedCpus == nil {
+			st.memcachedCpus = reserved
+		}
+		if st.memcachedCpus.String() != ev.Cpuset.String() {
+			st.memcachedSwitches++
+		}
+		st.memcachedCpus = ev.Cpuset
+	case EventLatency:
+		st.latencySamples++
+		if ev.LatencyP95Us > microseconds(slo) {
+			st.sloViolations++
+		}
+	}
+}
+
+// Summarize the run so far from the events recorded by the controller.
+func (cli *Controller) Summary() Summary {
+	st := &cli.stats
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	summary := Summary{
+		MemcachedSwitches: st.memcachedSwitches,
+		LatencySamples:    st.latencySamples,
+		SLOViolations:     st.sloViolations,
+	}
+
+	var first, last time.Time
+	for id, js := range st.jobs {
+		if js.started.IsZero() {
+			continue
+		}
+		job := JobSummary{
+			Name:      id,
+			Threads:   js.threads,
+			Started:   js.started,
+			Finished:  js.finished,
+			PauseTime: js.paused.Seconds(),
+			Pauses:    js.pauses,
+			Unpauses:  js.unpauses,
+			Completed: js.completed,
+		}
+		if first.IsZero() || js.started.Before(first) {
+			first = js.started
+		}
+		if !js.finished.IsZero() {
+			job.WallTime = js.finished.Sub(js.started).Seconds()
+			if js.finished.After(last) {
+				last = js.finished
+			}
+		}
+		job.CoreTime = js.coreTime.Seconds()
+		job.Work = js.work.Seconds()
+		if running := job.WallTime - job.PauseTime; running > 0 {
+			job.Cores = job.CoreTime / running
+		}
+		summary.Jobs = append(summary.Jobs, job)
+	}
+	if !last.IsZero() {
+		summary.Makespan = last.Sub(first).Seconds()
+	}
+
+	sort.Slice(summary.Jobs, func(i, j int) bool {
+		return summary.Jobs[i].Started.Before(summary.Jobs[j].Started)
+	})
+	return summary
+}
+
+// Print the summary as a table.
+func (summary Summary) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "job\twall time [s]\tpaused [s]\tcores\tpauses\tunpauses\tcompleted\t")
+	for _, job := range summary.Jobs {
+		fmt.Fprintf(tw, "%v\t%.1f\t%.1f\t%.2f\t%v\t%v\t%v\t\n",
+			job.Name, job.WallTime, job.PauseTime, job.Cores, job.Pauses, job.Unpauses, job.Completed)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nmakespan: %.1f s\nmemcached core switches: %v\n",
+		summary.Makespan, summary.MemcachedSwitches)
+	if err != nil || summary.LatencySamples == 0 {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "memcached SLO violations: %v of %v latency samples\n",
+		summary.SLOViolations, summary.LatencySamples)
+	return err
+}
+
+// Write summary.json and summary.txt into the result directory.
+func (summary Summary) Write(resultDir string) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path.Join(resultDir, "summary.json"), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path.Join(resultDir, "summary.txt"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return summary.WriteTable(f)
+}
@@ -0,0 +1,247 @@
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A logical cpu of the host.
+type Cpu struct {
+	ID     int
+	Socket int
+	Core   int // Physical core within the socket, shared by SMT siblings.
+	Node   int // NUMA node.
+}
+
+// Topology describes the online cpus of the host.
+type Topology struct {
+	Cpus []Cpu // Sorted by ID.
+}
+
+// Read the topology of the host from sysfs.
+func DiscoverTopology() (*Topology, error) {
+	return ReadTopology("/sys")
+}
+
+// Read the topology from a sysfs tree rooted at root. Missing details default to a single
+// socket and NUMA node, without SMT.
+func ReadTopology(root string) (*Topology, error) {
+	cpuDir := path.Join(root, "devices/system/cpu")
+	online, err := readCpuList(path.Join(cpuDir, "online"))
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int]int)
+	nodeDirs, _ := filepath.Glob(path.Join(root, "devices/system/node/node[0-9]*"))
+	for _, dir := range nodeDirs {
+		node, err := strconv.Atoi(strings.TrimPrefix(path.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+		cpus, err := readCpuList(path.Join(dir, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+		for _, cpu := range cpus {
+			nodes[cpu] = node
+		}
+	}
+
+	topo := &Topology{}
+	for _, id := range online {
+		dir := path.Join(cpuDir, fmt.Sprintf("cpu%v", id), "topology")
+		cpu := Cpu{ID: id, Core: id, Node: nodes[id]}
+		if socket, err := readInt(path.Join(dir, "physical_package_id")); err == nil {
+			cpu.Socket = socket
+		}
+		if core, err := readInt(path.Join(dir, "core_id")); err == nil {
+			cpu.Core = core
+		}
+		topo.Cpus = append(topo.Cpus, cpu)
+	}
+	return topo, nil
+}
+
+// A topology of ncpu cpus, each on its own core of a single socket.
+func UniformTopology(ncpu int) *Topology {
+	topo := &Topology{Cpus: make([]Cpu, ncpu)}
+	for id := range topo.Cpus {
+		topo.Cpus[id] = Cpu{ID: id, Core: id}
+	}
+	return topo
+}
+
+func (t *Topology) Online() CpuList {
+	cpus := make(CpuList, len(t.Cpus))
+	for i, cpu := range t.Cpus {
+		cpus[i] = cpu.ID
+	}
+	return cpus
+}
+
+// One more than the highest cpu id, the size of tables indexed by cpu.
+func (t *Topology) Size() int {
+	if len(t.Cpus) == 0 {
+		return 0
+	}
+	return t.Cpus[len(t.Cpus)-1].ID + 1
+}
+
+func (t *Topology) Cpu(id int) (Cpu, bool) {
+	i := sort.Search(len(t.Cpus), func(i int) bool { return t.Cpus[i].ID >= id })
+	if i < len(t.Cpus) && t.Cpus[i].ID == id {
+		return t.Cpus[i], true
+	}
+	return Cpu{}, false
+}
+
+// The cpus sharing the physical core of a cpu, itself included.
+func (t *Topology) Siblings(id int) CpuList {
+	cpu, ok := t.Cpu(id)
+	if !ok {
+		return nil
+	}
+	var siblings CpuList
+	for _, c := range t.Cpus {
+		if c.Socket == cpu.Socket && c.Core == cpu.Core {
+			siblings = append(siblings, c.ID)
+		}
+	}
+	return siblings
+}
+
+// The NUMA node of a cpu.
+func (t *Topology) Node(id int) int {
+	cpu, _ := t.Cpu(id)
+	return cpu.Node
+}
+
+// Split cpus by NUMA node, keeping their order. Nodes come in the order of their first cpu.
+func (t *Topology) ByNode(cpus CpuList) []CpuList {
+	var groups []CpuList
+	index := make(map[int]int)
+	for _, id := range cpus {
+		node := t.Node(id)
+		i, ok := index[node]
+		if !ok {
+			i = len(groups)
+			index[node] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], id)
+	}
+	return groups
+}
+
+// The cpus that are not SMT siblings of any of the given cpus.
+func (t *Topology) WithoutSiblingsOf(cpus, of CpuList) CpuList {
+	exclude := make(map[int]bool)
+	for _, id := range of {
+		for _, sibling := range t.Siblings(id) {
+			exclude[sibling] = true
+		}
+	}
+	var rest CpuList
+	for _, id := range cpus {
+		if !exclude[id] {
+			rest = append(rest, id)
+		}
+	}
+	return rest
+}
+
+func (t *Topology) String() string {
+	sockets := make(map[int]bool)
+	cores := make(map[[2]int]bool)
+	nodes := make(map[int]bool)
+	for _, cpu := range t.Cpus {
+		sockets[cpu.Socket] = true
+		cores[[2]int{cpu.Socket, cpu.Core}] = true
+		nodes[cpu.Node] = true
+	}
+	return fmt.Sprintf("%v cpus (%v), %v cores, %v sockets, %v NUMA nodes",
+		len(t.Cpus), t.Online(), len(cores), len(sockets), len(nodes))
+}
+
+// Rules for placing jobs on cpus.
+type PlacementPolicy struct {
+	AvoidMemcachedSiblings bool // Never run jobs on SMT siblings of the cpus of memcached.
+	SameNode               bool // Keep the cpus of a job within one NUMA node when enough are free.
+}
+
+// Check that a set of cpus reserved for memcached is online and leaves room for jobs.
+func (t *Topology) CheckReserved(reserved CpuList) error {
+	if len(reserved) == 0 {
+		return fmt.Errorf("no cpus reserved for memcached")
+	}
+	seen := make(map[int]bool)
+	for _, id := range reserved {
+		if _, ok := t.Cpu(id); !ok {
+			return fmt.Errorf("reserved cpu %v is not online", id)
+		}
+		if seen[id] {
+			return fmt.Errorf("reserved cpu %v is listed twice", id)
+		}
+		seen[id] = true
+	}
+	if len(reserved) == 1 && len(t.Cpus) == 1 {
+		return fmt.Errorf("no cpus left for jobs")
+	}
+	return nil
+}
+
+// Parse a cpu list in the kernel format, e.g. "0-3,6". Each cpu may appear only once.
+func ParseCpuList(s string) (CpuList, error) {
+	var cpus CpuList
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return cpus, nil
+	}
+	if strings.ContainsAny(s, " \t\n") {
+		return nil, fmt.Errorf("invalid cpu list %q: unexpected whitespace", s)
+	}
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu list %q", s)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil || last < first {
+				return nil, fmt.Errorf("invalid cpu list %q", s)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			if seen[cpu] {
+				return nil, fmt.Errorf("invalid cpu list %q: cpu %v appears twice", s, cpu)
+			}
+			seen[cpu] = true
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+func readCpuList(file string) (CpuList, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCpuList(string(data))
+}
+
+func readInt(file string) (int, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCpuList(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want CpuList
+		err  string
+	}{
+		{in: "", want: nil},
+		{in: "0\n", want: CpuList{0}},
+		{in: "0-3,6", want: CpuList{0, 1, 2, 3, 6}},
+		{in: "2,0", want: CpuList{2, 0}}, // The order is kept: memcached runs on the first.
+		{in: "4-4", want: CpuList{4}},
+		{in: "0,0", err: "cpu 0 appears twice"},
+		{in: "0-2,1", err: "cpu 1 appears twice"},
+		{in: "0, 1", err: "whitespace"},
+		{in: "0 -1", err: "whitespace"},
+		{in: "3-1", err: "invalid"},
+		{in: "0,", err: "invalid"},
+		{in: "a", err: "invalid"},
+		{in: "-1", err: "invalid"},
+	} {
+		got, err := ParseCpuList(tc.in)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("ParseCpuList(%q) = %v, %v, want error about %q", tc.in, got, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseCpuList(%q) = %v, %v, want %v", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestCheckReserved(t *testing.T) {
+	topo := UniformTopology(4)
+	for _, tc := range []struct {
+		reserved CpuList
+		ok       bool
+	}{
+		{CpuList{0, 1}, true},
+		{CpuList{3}, true},
+		{nil, false},
+		{CpuList{4}, false},    // Not online.
+		{CpuList{0, 0}, false}, // Listed twice.
+	} {
+		if err := topo.CheckReserved(tc.reserved); (err == nil) != tc.ok {
+			t.Errorf("CheckReserved(%v) = %v, want ok %v", tc.reserved, err, tc.ok)
+		}
+	}
+	if err := UniformTopology(1).CheckReserved(CpuList{0}); err == nil {
+		t.Errorf("reserving the only cpu leaves none for jobs, want an error")
+	}
+}
+
+// Write a sysfs tree of files with the given contents under a temporary directory.
+func writeSysfs(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, data := range files {
+		file := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestReadTopology(t *testing.T) {
+	// Two sockets, each a NUMA node with two cores of two SMT threads, and cpu 5 offline.
+	files := map[string]string{
+		"devices/system/cpu/online":         "0-4,6-7\n",
+		"devices/system/node/node0/cpulist": "0-1,4-5\n",
+		"devices/system/node/node1/cpulist": "2-3,6-7\n",
+	}
+	for id, cpu := range []Cpu{
+		{ID: 0, Socket: 0, Core: 0}, {ID: 1, Socket: 0, Core: 1},
+		{ID: 2, Socket: 1, Core: 0}, {ID: 3, Socket: 1, Core: 1},
+		{ID: 4, Socket: 0, Core: 0}, {ID: 5, Socket: 0, Core: 1},
+		{ID: 6, Socket: 1, Core: 0}, {ID: 7, Socket: 1, Core: 1},
+	} {
+		dir := fmt.Sprintf("devices/system/cpu/cpu%v/topology", id)
+		files[dir+"/physical_package_id"] = fmt.Sprintln(cpu.Socket)
+		files[dir+"/core_id"] = fmt.Sprintln(cpu.Core)
+	}
+	topo, err := ReadTopology(writeSysfs(t, files))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Cpu{
+		{ID: 0, Socket: 0, Core: 0, Node: 0},
+		{ID: 1, Socket: 0, Core: 1, Node: 0},
+		{ID: 2, Socket: 1, Core: 0, Node: 1},
+		{ID: 3, Socket: 1, Core: 1, Node: 1},
+		{ID: 4, Socket: 0, Core: 0, Node: 0},
+		{ID: 6, Socket: 1, Core: 0, Node: 1},
+		{ID: 7, Socket: 1, Core: 1, Node: 1},
+	}
+	if !reflect.DeepEqual(topo.Cpus, want) {
+		t.Errorf("cpus %+v, want %+v", topo.Cpus, want)
+	}
+	if got, want := topo.Size(), 8; got != want {
+		t.Errorf("size %v, want %v", got, want)
+	}
+	if got, want := topo.Siblings(0), (CpuList{0, 4}); !reflect.DeepEqual(got, want) {
+		t.Errorf("siblings of cpu 0: %v, want %v", got, want)
+	}
+	if got, want := topo.Siblings(1), (CpuList{1}); !reflect.DeepEqual(got, want) {
+		t.Errorf("siblings of cpu 1: %v, want %v (its sibling is offline)", got, want)
+	}
+	if got, want := topo.ByNode(CpuList{0, 2, 4, 6}), []CpuList{{0, 4}, {2, 6}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("by node: %v, want %v", got, want)
+	}
+}
+
+func TestReadTopologyDefaults(t *testing.T) {
+	// Without topology or NUMA details, every cpu is its own core on one socket and node.
+	topo, err := ReadTopology(writeSysfs(t, map[string]string{
+		"devices/system/cpu/online": "0-2\n",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := topo.Cpus, UniformTopology(3).Cpus; !reflect.DeepEqual(got, want) {
+		t.Errorf("cpus %+v, want %+v", got, want)
+	}
+
+	if _, err := ReadTopology(t.TempDir()); err == nil {
+		t.Errorf("no online cpus file, want an error")
+	}
+}
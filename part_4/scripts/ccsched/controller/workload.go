@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Everything a runtime needs to launch a job.
+type Workload struct {
+	Image      string
+	Command    []string // Overrides the entrypoint of the image when set.
+	Args       []string // Overrides the default arguments of the image when set.
+	Env        []string // KEY=VALUE pairs.
+	WorkingDir string
+}
+
+// Name of the PARSEC package run by the job, e.g. splash2x-fft runs splash2x.fft.
+func parsecPackage(name string) string {
+	if strings.HasPrefix(name, "splash2x-") {
+		return "splash2x." + strings.TrimPrefix(name, "splash2x-")
+	}
+	return name
+}
+
+// Resolve the workload of the job. A job without an image runs the PARSEC benchmark
+// named after it. Every job sees its thread count in CCSCHED_THREADS.
+func (job *JobInfo) Workload() Workload {
+	w := Workload{
+		Image:      job.Image,
+		Command:    job.Command,
+		Args:       job.Args,
+		WorkingDir: job.WorkingDir,
+	}
+	if w.Image == "" {
+		w.Image = fmt.Sprintf("anakli/parsec:%v-native-reduced", job.Name)
+		if len(w.Command) == 0 && len(w.Args) == 0 {
+			w.Args = []string{"./bin/parsecmgmt", "-a", "run",
+				"-p", parsecPackage(job.Name), "-i", "native", "-n", strconv.Itoa(job.Threads)}
+		}
+	}
+
+	keys := make([]string, 0, len(job.Env))
+	for k := range job.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	w.Env = append(w.Env, "CCSCHED_THREADS="+strconv.Itoa(job.Threads))
+	for _, k := range keys {
+		w.Env = append(w.Env, k+"="+job.Env[k])
+	}
+	return w
+}
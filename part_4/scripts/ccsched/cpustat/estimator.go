@@ -0,0 +1,41 @@
+package cpustat
+
+import "math"
+
+// Reduces a window of samples, oldest first, to a single value. An empty window is 0.
+type Estimator interface {
+	Estimate(samples []float64) float64
+}
+
+// An Estimator from a plain function.
+type EstimatorFunc func(samples []float64) float64
+
+func (f EstimatorFunc) Estimate(samples []float64) float64 {
+	return f(samples)
+}
+
+var (
+	// The lowest sample: above a threshold only if all samples are.
+	Min Estimator = EstimatorFunc(func(samples []float64) float64 {
+		if len(samples) == 0 {
+			return 0
+		}
+		min := samples[0]
+		for _, v := range samples[1:] {
+			min = math.Min(min, v)
+		}
+		return min
+	})
+
+	// The highest sample: below a threshold only if all samples are.
+	Max Estimator = EstimatorFunc(func(samples []float64) float64 {
+		if len(samples) == 0 {
+			return 0
+		}
+		max := samples[0]
+		for _, v := range samples[1:] {
+			max = math.Max(max, v)
+		}
+		return max
+	})
+)
@@ -0,0 +1,94 @@
+// Package cpustat keeps a sliding window of utilization samples per cpu and summarizes
+// it with estimators, so that schedulers react to trends rather than to a single sample.
+package cpustat
+
+// A fixed number of the latest samples, overwriting the oldest one when full.
+type Ring struct {
+	samples []float64
+	next    int // Where the next sample goes.
+	n       int // Number of samples so far, up to the length of the ring.
+}
+
+func NewRing(length int) *Ring {
+	if length < 1 {
+		length = 1
+	}
+	return &Ring{samples: make([]float64, length)}
+}
+
+func (r *Ring) Add(v float64) {
+	r.samples[r.next] = v
+	r.next = (r.next + 1) % len(r.samples)
+	if r.n < len(r.samples) {
+		r.n++
+	}
+}
+
+// Fill the whole ring with v, as if it had been sampled all along.
+func (r *Ring) Fill(v float64) {
+	for i := range r.samples {
+		r.samples[i] = v
+	}
+	r.next = 0
+	r.n = len(r.samples)
+}
+
+// Number of samples in the ring.
+func (r *Ring) Len() int {
+	return r.n
+}
+
+// Whether the ring holds as many samples as its length.
+func (r *Ring) Full() bool {
+	return r.n == len(r.samples)
+}
+
+// A copy of the samples, oldest first.
+func (r *Ring) Samples() []float64 {
+	out := make([]float64, 0, r.n)
+	for i := r.n; i >= 1; i-- {
+		out = append(out, r.samples[(r.next+len(r.samples)-i)%len(r.samples)])
+	}
+	return out
+}
+
+// Summarize the samples with e.
+func (r *Ring) Estimate(e Estimator) float64 {
+	return e.Estimate(r.Samples())
+}
+
+// A ring of samples per cpu, indexed by cpu number.
+type Window struct {
+	cores []*Ring
+}
+
+// Create a window of the given length for cpus 0 to ncpu-1.
+func NewWindow(ncpu, length int) *Window {
+	w := &Window{cores: make([]*Ring, ncpu)}
+	for c := range w.cores {
+		w.cores[c] = NewRing(length)
+	}
+	return w
+}
+
+// Fill the window of every cpu with v.
+func (w *Window) Fill(v float64) {
+	for _, r := range w.cores {
+		r.Fill(v)
+	}
+}
+
+// Record a sample of every cpu. Cpus missing from usage, or beyond the window, are skipped.
+func (w *Window) Add(usage []float64) {
+	for c := 0; c < len(w.cores) && c < len(usage); c++ {
+		w.cores[c].Add(usage[c])
+	}
+}
+
+// The samples of a cpu, nil if the window does not cover it.
+func (w *Window) Core(cpu int) *Ring {
+	if cpu < 0 || cpu >= len(w.cores) {
+		return nil
+	}
+	return w.cores[cpu]
+}
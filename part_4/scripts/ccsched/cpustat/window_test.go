@@ -0,0 +1,79 @@
+package cpustat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing(3)
+	if r.Len() != 0 || r.Full() || len(r.Samples()) != 0 {
+		t.Fatalf("new ring has samples %v", r.Samples())
+	}
+	for i, want := range [][]float64{
+		{1},
+		{1, 2},
+		{1, 2, 3},
+		{2, 3, 4}, // The oldest sample is overwritten.
+		{3, 4, 5},
+		{4, 5, 6},
+		{5, 6, 7}, // Around a second time.
+	} {
+		r.Add(float64(i + 1))
+		if got := r.Samples(); !reflect.DeepEqual(got, want) {
+			t.Errorf("after %v samples: %v, want %v", i+1, got, want)
+		}
+		if r.Len() != len(want) || r.Full() != (len(want) == 3) {
+			t.Errorf("after %v samples: length %v, full %v", i+1, r.Len(), r.Full())
+		}
+	}
+}
+
+func TestRingFill(t *testing.T) {
+	r := NewRing(3)
+	r.Add(1)
+	r.Fill(100)
+	if got, want := r.Samples(), []float64{100, 100, 100}; !reflect.DeepEqual(got, want) || !r.Full() {
+		t.Errorf("filled ring: %v, want %v", got, want)
+	}
+	r.Add(5)
+	if got, want := r.Samples(), []float64{100, 100, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after a sample: %v, want %v", got, want)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	w := NewWindow(2, 2)
+	w.Fill(50)
+	w.Add([]float64{10, 20, 30}) // The third cpu is beyond the window.
+	w.Add([]float64{40})         // The second cpu is missing.
+	if got, want := w.Core(0).Samples(), []float64{10, 40}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cpu 0: %v, want %v", got, want)
+	}
+	if got, want := w.Core(1).Samples(), []float64{50, 20}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cpu 1: %v, want %v", got, want)
+	}
+	if w.Core(2) != nil || w.Core(-1) != nil {
+		t.Error("window covers cpus it was not created for")
+	}
+}
+
+func TestEstimators(t *testing.T) {
+	samples := []float64{30, 90, 10, 50}
+	for _, test := range []struct {
+		name    string
+		e       Estimator
+		samples []float64
+		want    float64
+	}{
+		{"min", Min, samples, 10},
+		{"max", Max, samples, 90},
+		{"min of none", Min, nil, 0},
+		{"max of none", Max, nil, 0},
+		{"func", EstimatorFunc(func(s []float64) float64 { return s[len(s)-1] }), samples, 50},
+	} {
+		if got := test.e.Estimate(test.samples); got != test.want {
+			t.Errorf("%v of %v = %v, want %v", test.name, test.samples, got, test.want)
+		}
+	}
+}
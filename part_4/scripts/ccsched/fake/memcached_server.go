@@ -0,0 +1,106 @@
+package fake
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemcachedServer speaks enough of the memcached text protocol (get and set) to stand in
+// for memcached when probing its latency.
+type MemcachedServer struct {
+	// Time taken by every request, if set.
+	Delay func() time.Duration
+
+	ln    net.Listener
+	mu    sync.Mutex
+	items map[string]string
+}
+
+// Listen on addr, e.g. "127.0.0.1:0" for any free port.
+func NewMemcachedServer(addr string) (*MemcachedServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &MemcachedServer{ln: ln, items: make(map[string]string)}
+	go s.serve()
+	return s, nil
+}
+
+// Address the server listens on.
+func (s *MemcachedServer) Addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *MemcachedServer) Close() error {
+	return s.ln.Close()
+}
+
+func (s *MemcachedServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *MemcachedServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if s.Delay != nil {
+			time.Sleep(s.Delay())
+		}
+
+		var reply string
+		switch {
+		case fields[0] == "get" && len(fields) > 1:
+			s.mu.Lock()
+			for _, key := range fields[1:] {
+				if value, ok := s.items[key]; ok {
+					reply += fmt.Sprintf("VALUE %v 0 %v\r\n%v\r\n", key, len(value), value)
+				}
+			}
+			s.mu.Unlock()
+			reply += "END\r\n"
+		case fields[0] == "set" && len(fields) >= 5:
+			// set <key> <flags> <exptime> <bytes> [noreply], followed by the data.
+			n, err := strconv.Atoi(fields[4])
+			if err != nil {
+				reply = "CLIENT_ERROR bad data chunk\r\n"
+				break
+			}
+			data := make([]byte, n+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.items[fields[1]] = string(data[:n])
+			s.mu.Unlock()
+			if len(fields) < 6 || fields[5] != "noreply" {
+				reply = "STORED\r\n"
+			}
+		default:
+			reply = "ERROR\r\n"
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,389 @@
+// Package fake provides an in-memory runtime, cpu sampler and memcached pinner
+// so that schedulers can be driven deterministically without a Docker daemon.
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"ethz.ch/ccsched/controller"
+)
+
+// Start time of every simulated run.
+var Epoch = time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+type job struct {
+	name      string
+	threads   int
+	state     controller.JobState
+	cpuList   controller.CpuList
+	work      time.Duration // cpu time needed on a single core.
+	done      time.Duration // Progress so far, in cpu time on a single core.
+	cpuTime   time.Duration // cpu time received so far.
+	exitCode  int
+	pauses    int
+	startedAt time.Time
+	exitedAt  time.Time
+}
+
+// Runtime simulates jobs whose progress depends on the cpus they are pinned to.
+// A running job progresses at the rate of the cpus it owns, capped by its thread count;
+// cpus shared between several jobs are split evenly. Time only moves on Advance.
+// Events are delivered synchronously, so they are all buffered by the time Advance returns.
+type Runtime struct {
+	// Single-core cpu time needed by each job; defaults to Eta * Threads.
+	Work map[string]time.Duration
+
+	// Speedup of each job on a number of cores over a single core. Jobs without one
+	// speed up linearly.
+	Speedup map[string]func(cores float64) float64
+
+	// Exit code of each job once it has done its work; 0 by default.
+	ExitCodes map[string]int
+
+	mu        sync.Mutex
+	now       time.Time
+	jobs      map[string]*job
+	completed []string
+	subs      []chan controller.JobEvent
+}
+
+func NewRuntime() *Runtime {
+	return &Runtime{
+		Work:      make(map[string]time.Duration),
+		Speedup:   make(map[string]func(float64) float64),
+		ExitCodes: make(map[string]int),
+		now:       Epoch,
+		jobs:      make(map[string]*job),
+	}
+}
+
+func (rt *Runtime) Now() time.Time {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.now
+}
+
+func (rt *Runtime) lookup(id string) (*job, error) {
+	j, ok := rt.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", controller.ErrNotFound, id)
+	}
+	return j, nil
+}
+
+func (rt *Runtime) Create(ctx context.Context, info *controller.JobInfo) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if _, ok := rt.jobs[info.Name]; ok {
+		return fmt.Errorf("%w: %v already exists", controller.ErrConflict, info.Name)
+	}
+	work, ok := rt.Work[info.Name]
+	if !ok {
+		work = info.Eta * time.Duration(info.Threads)
+	}
+	rt.jobs[info.Name] = &job{
+		name:    info.Name,
+		threads: info.Threads,
+		state:   controller.StateCreated,
+		work:    work,
+	}
+	return nil
+}
+
+func (rt *Runtime) Start(ctx context.Context, id string) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	j, err := rt.lookup(id)
+	if err != nil {
+		return err
+	}
+	if j.state != controller.StateCreated {
+		return fmt.Errorf("%w: %v is %v", controller.ErrConflict, id, j.state)
+	}
+	j.state = controller.StateRunning
+	j.startedAt = rt.now
+	return nil
+}
+
+func (rt *Runtime) Pause(ctx context.Context, id string) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	j, err := rt.lookup(id)
+	if err != nil {
+		return err
+	}
+	if j.state != controller.StateRunning {
+		return fmt.Errorf("%w: %v is %v", controller.ErrConflict, id, j.state)
+	}
+	j.state = controller.StatePaused
+	j.pauses++
+	rt.emit(controller.JobEvent{Type: controller.JobPaused, Job: id})
+	return nil
+}
+
+func (rt *Runtime) Unpause(ctx context.Context, id string) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	j, err := rt.lookup(id)
+	if err != nil {
+		return err
+	}
+	if j.state != controller.StatePaused {
+		return fmt.Errorf("%w: %v is %v", controller.ErrConflict, id, j.state)
+	}
+	j.state = controller.StateRunning
+	rt.emit(controller.JobEvent{Type: controller.JobUnpaused, Job: id})
+	return nil
+}
+
+func (rt *Runtime) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	j, err := rt.lookup(id)
+	if err != nil {
+		return err
+	}
+	if j.state != controller.StateRunning {
+		return fmt.Errorf("%w: %v is %v", controller.ErrConflict, id, j.state)
+	}
+	j.state = controller.StateExited
+	j.exitCode = 137
+	j.exitedAt = rt.now
+	rt.emit(controller.JobEvent{Type: controller.JobExited, Job: id, ExitCode: j.exitCode})
+	return nil
+}
+
+func (rt *Runtime) Remove(ctx context.Context, id string) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if _, err := rt.lookup(id); err != nil {
+		return err
+	}
+	delete(rt.jobs, id)
+	return nil
+}
+
+func (rt *Runtime) SetCpuset(ctx context.Context, id string, cpuList controller.CpuList) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	j, err := rt.lookup(id)
+	if err != nil {
+		return err
+	}
+	j.cpuList = append(controller.CpuList(nil), cpuList...)
+	return nil
+}
+
+func (rt *Runtime) Inspect(ctx context.Context, id string) (controller.JobStatus, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	j, err := rt.lookup(id)
+	if err != nil {
+		return controller.JobStatus{}, err
+	}
+	return controller.JobStatus{State: j.state, ExitCode: j.exitCode}, nil
+}
+
+func (rt *Runtime) Logs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	j, err := rt.lookup(id)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "%v: %v of %v cpu time\n", j.name, j.done, j.work)
+	return err
+}
+
+func (rt *Runtime) Info(ctx context.Context, id string) ([]byte, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	j, err := rt.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"Name":     j.name,
+		"State":    j.state,
+		"CpuList":  j.cpuList,
+		"Pauses":   j.pauses,
+		"Started":  j.startedAt,
+		"Finished": j.exitedAt,
+	})
+}
+
+// Capacity of each event subscription; a scheduler drains it at every cpu sample.
+const eventBuffer = 4096
+
+func (rt *Runtime) Events(ctx context.Context) <-chan controller.JobEvent {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	ch := make(chan controller.JobEvent, eventBuffer)
+	rt.subs = append(rt.subs, ch)
+	return ch
+}
+
+func (rt *Runtime) emit(ev controller.JobEvent) {
+	ev.Time = rt.now
+	for _, ch := range rt.subs {
+		select {
+		case ch <- ev:
+		default:
+			panic("fake: job event buffer full")
+		}
+	}
+}
+
+// Cores received by each running job at the current instant.
+func (rt *Runtime) rates() map[string]float64 {
+	users := make(map[int]int)
+	for _, j := range rt.jobs {
+		if j.state == controller.StateRunning {
+			for _, core := range j.cpuList {
+				users[core]++
+			}
+		}
+	}
+	rates := make(map[string]float64)
+	for id, j := range rt.jobs {
+		if j.state != controller.StateRunning {
+			continue
+		}
+		rate := 0.0
+		for _, core := range j.cpuList {
+			rate += 1 / float64(users[core])
+		}
+		if rate > float64(j.threads) {
+			rate = float64(j.threads)
+		}
+		rates[id] = rate
+	}
+	return rates
+}
+
+// Move the clock forward, letting running jobs progress and exit.
+func (rt *Runtime) Advance(d time.Duration) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.advance(d)
+}
+
+func (rt *Runtime) advance(d time.Duration) {
+
+	end := rt.now.Add(d)
+	for rt.now.Before(end) {
+		// Advance up to the next job completion, as it changes the share of the other jobs.
+		cores := rt.rates()
+		rates := make(map[string]float64, len(cores))
+		step := end.Sub(rt.now)
+		for id, n := range cores {
+			j := rt.jobs[id]
+			rate := n
+			if speedup, ok := rt.Speedup[id]; ok {
+				rate = speedup(n)
+			}
+			rates[id] = rate
+			if rate == 0 {
+				continue
+			}
+			left := time.Duration(float64(j.work-j.done) / rate)
+			if left < step {
+				step = left
+			}
+		}
+		rt.now = rt.now.Add(step)
+		// Jobs exiting at the same instant are reported in name order.
+		ids := make([]string, 0, len(rates))
+		for id := range rates {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			rate := rates[id]
+			j := rt.jobs[id]
+			j.done += time.Duration(float64(step) * rate)
+			j.cpuTime += time.Duration(float64(step) * cores[id])
+			if j.done >= j.work-time.Microsecond {
+				j.done = j.work
+				j.state = controller.StateExited
+				j.exitCode = rt.ExitCodes[id]
+				j.exitedAt = rt.now
+				rt.completed = append(rt.completed, id)
+				rt.emit(controller.JobEvent{Type: controller.JobExited, Job: id, ExitCode: j.exitCode})
+			}
+		}
+	}
+}
+
+// Cpu time received by a job so far, like the cpu accounting of its cgroup.
+func (rt *Runtime) CpuUsage(ctx context.Context, id string) (time.Duration, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	j, err := rt.lookup(id)
+	if err != nil {
+		return 0, err
+	}
+	switch j.state {
+	case controller.StateCreated:
+		return 0, fmt.Errorf("%w: %v has not started", controller.ErrConflict, id)
+	case controller.StateExited:
+		return 0, fmt.Errorf("%w: %v", controller.ErrAlreadyExited, id)
+	}
+	return j.cpuTime, nil
+}
+
+// Number of times a job has been paused.
+func (rt *Runtime) Pauses(id string) int {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if j, ok := rt.jobs[id]; ok {
+		return j.pauses
+	}
+	return 0
+}
+
+// Names of the exited jobs, in the order they exited.
+func (rt *Runtime) Completed() []string {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	return append([]string(nil), rt.completed...)
+}
+
+// Time between the first job start and the last job exit.
+func (rt *Runtime) Makespan() time.Duration {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	var first, last time.Time
+	for _, j := range rt.jobs {
+		if !j.startedAt.IsZero() && (first.IsZero() || j.startedAt.Before(first)) {
+			first = j.startedAt
+		}
+		if j.exitedAt.After(last) {
+			last = j.exitedAt
+		}
+	}
+	if first.IsZero() || last.IsZero() {
+		return 0
+	}
+	return last.Sub(first)
+}
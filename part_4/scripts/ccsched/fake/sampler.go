@@ -0,0 +1,207 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"ethz.ch/ccsched/controller"
+)
+
+// Memcached records how memcached has been configured.
+type Memcached struct {
+	mu       sync.Mutex
+	CpuList  controller.CpuList
+	Switches int // Number of times the cpu set has changed.
+	Threads  int
+	Restarts int
+	Down     bool // Fail health checks.
+
+	cpuTime time.Duration // Cpu time used so far, as served by the Sampler.
+}
+
+func (m *Memcached) SetCpuAffinity(ctx context.Context, cpuList controller.CpuList) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.CpuList.String() != cpuList.String() {
+		m.Switches++
+	}
+	m.CpuList = append(controller.CpuList(nil), cpuList...)
+	return nil
+}
+
+func (m *Memcached) SetThreads(ctx context.Context, threads int) error {
+	m.mu.Lock()
+	m.Threads = threads
+	m.mu.Unlock()
+	return m.Restart(ctx)
+}
+
+func (m *Memcached) Restart(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Restarts++
+	return nil
+}
+
+func (m *Memcached) Health(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Down {
+		return errors.New("memcached is down")
+	}
+	return nil
+}
+
+func (m *Memcached) CpuUsage(ctx context.Context) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cpuTime, nil
+}
+
+func (m *Memcached) cpus() controller.CpuList {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.CpuList
+}
+
+// Sampler advances the runtime by the sampling interval and reports the resulting usage:
+// a cpu running a job is fully busy, and the memcached load is spread over its cpus.
+type Sampler struct {
+	Runtime   *Runtime
+	Memcached *Memcached
+	Ncpu      int
+
+	// Memcached load, in percent of a single core, at a time since Epoch.
+	Load func(t time.Duration) float64
+
+	Ticks int // Number of samples taken.
+}
+
+func (s *Sampler) Percent(interval time.Duration) ([]float64, error) {
+	// Jobs must not change between advancing and measuring.
+	rt := s.Runtime
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.advance(interval)
+	s.Ticks++
+	memcachedCpus := s.Memcached.cpus()
+
+	usage := make([]float64, s.Ncpu)
+	for _, j := range rt.jobs {
+		if j.state != controller.StateRunning {
+			continue
+		}
+		for _, core := range j.cpuList {
+			if core < s.Ncpu {
+				usage[core] = 100
+			}
+		}
+	}
+	if s.Load != nil && len(memcachedCpus) > 0 {
+		load := s.Load(rt.now.Sub(Epoch))
+		share := load / float64(len(memcachedCpus))
+		for _, core := range memcachedCpus {
+			if core < s.Ncpu {
+				usage[core] += share
+			}
+		}
+		// memcached gets all the cpu time it needs, up to its cpus.
+		if max := float64(100 * len(memcachedCpus)); load > max {
+			load = max
+		}
+		s.Memcached.mu.Lock()
+		s.Memcached.cpuTime += time.Duration(load / 100 * float64(interval))
+		s.Memcached.mu.Unlock()
+	}
+	for core := range usage {
+		if usage[core] > 100 {
+			usage[core] = 100
+		}
+	}
+	return usage, nil
+}
+
+// Latency models memcached as a queue: its p95 latency grows as its cpus fill up.
+type Latency struct {
+	Runtime   *Runtime
+	Memcached *Memcached
+	Load      func(t time.Duration) float64 // Same as Sampler.Load.
+	Base      time.Duration                 // p95 latency of an idle memcached.
+}
+
+func (l *Latency) Percentiles() (controller.LatencyStats, error) {
+	l.Runtime.mu.Lock()
+	t := l.Runtime.now.Sub(Epoch)
+	l.Runtime.mu.Unlock()
+
+	p95 := l.Base
+	if cores := len(l.Memcached.cpus()); cores > 0 && l.Load != nil {
+		util := l.Load(t) / float64(100*cores)
+		if util > 0.99 {
+			util = 0.99
+		}
+		p95 = time.Duration(float64(l.Base) / (1 - util))
+	}
+	return controller.LatencyStats{P50: p95 / 2, P95: p95, P99: 2 * p95}, nil
+}
+
+// Pressure models the cpu stalls of memcached as a queue on its cpus: requests wait
+// while all of its cpus are busy.
+type Pressure struct {
+	Runtime   *Runtime
+	Memcached *Memcached
+	Load      func(t time.Duration) float64 // Same as Sampler.Load.
+}
+
+func (p *Pressure) Pressure() (controller.PressureSample, error) {
+	p.Runtime.mu.Lock()
+	t := p.Runtime.now.Sub(Epoch)
+	p.Runtime.mu.Unlock()
+
+	var stall controller.Pressure
+	if cores := len(p.Memcached.cpus()); cores > 0 && p.Load != nil {
+		util := p.Load(t) / float64(100*cores)
+		if util > 1 {
+			util = 1
+		}
+		stall.Some = 100 * math.Pow(util, float64(cores+1))
+	}
+	return controller.PressureSample{Cpu: stall, Memcached: stall}, nil
+}
+
+// Env bundles the fakes that make up a simulated host.
+type Env struct {
+	Runtime   *Runtime
+	Memcached *Memcached
+	Sampler   *Sampler
+	Latency   *Latency
+	Pressure  *Pressure
+}
+
+// Create a simulated host with ncpu cpus and the given memcached load.
+func NewEnv(ncpu int, load func(t time.Duration) float64) *Env {
+	rt := NewRuntime()
+	memcached := &Memcached{}
+	return &Env{
+		Runtime:   rt,
+		Memcached: memcached,
+		Sampler:   &Sampler{Runtime: rt, Memcached: memcached, Ncpu: ncpu, Load: load},
+		Latency:   &Latency{Runtime: rt, Memcached: memcached, Load: load, Base: 250 * time.Microsecond},
+		Pressure:  &Pressure{Runtime: rt, Memcached: memcached, Load: load},
+	}
+}
+
+// A controller that drives the simulated host by cpu usage. Set its Latency to env.Latency
+// to steer memcached by latency instead, or its Pressure to env.Pressure to use stalls too.
+func (env *Env) Controller() *controller.Controller {
+	return &controller.Controller{
+		Runtime:   env.Runtime,
+		Clock:     env.Runtime,
+		Sampler:   env.Sampler,
+		Memcached: env.Memcached,
+		Topology:  controller.UniformTopology(env.Sampler.Ncpu),
+	}
+}
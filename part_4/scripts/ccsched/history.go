@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+
+	"ethz.ch/ccsched/history"
+)
+
+func historyFile(stateDir string) string {
+	return path.Join(stateDir, "history.json")
+}
+
+func historyUsage(fs *flag.FlagSet) func() {
+	return func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: ccsched [--state-dir <dir>] history list|jobs|export [flags]")
+		fmt.Fprintln(out, "       ccsched [--state-dir <dir>] history show <run>")
+		fs.PrintDefaults()
+	}
+}
+
+// Query the runs recorded in the state directory.
+func runHistory(stateDir string, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	schedName := fs.String("scheduler", "", "only the runs of this scheduler")
+	jobName := fs.String("job", "", "only this job")
+	completed := fs.Bool("completed", false, "only completed jobs of runs that were not interrupted")
+	format := fs.String("format", "csv", "format of export: csv or json")
+	fs.Usage = historyUsage(fs)
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	cmd := args[0]
+	fs.Parse(args[1:])
+
+	store, err := history.Open(historyFile(stateDir))
+	if err != nil {
+		return err
+	}
+	runs := store.Query(history.Filter{Scheduler: *schedName, Job: *jobName, Completed: *completed})
+
+	switch cmd {
+	case "list":
+		return history.WriteRunTable(os.Stdout, runs)
+	case "jobs":
+		return history.WriteJobTable(os.Stdout, history.JobStatsOf(runs))
+	case "export":
+		switch *format {
+		case "csv":
+			return history.WriteCSV(os.Stdout, runs)
+		case "json":
+			return history.WriteJSON(os.Stdout, runs)
+		}
+		return fmt.Errorf("unknown export format %q", *format)
+	case "show":
+		if fs.NArg() != 1 {
+			return errors.New("history show needs a run")
+		}
+		run, ok := store.Find(fs.Arg(0))
+		if !ok {
+			return fmt.Errorf("no run %v in %v", fs.Arg(0), historyFile(stateDir))
+		}
+		fmt.Printf("run %v of %v, results in %v\n\n", run.ID, run.Scheduler, run.ResultDir)
+		return run.WriteTable(os.Stdout)
+	}
+	return fmt.Errorf("unknown history command %q", cmd)
+}
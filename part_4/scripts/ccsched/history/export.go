@@ -0,0 +1,75 @@
+package history
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Write the runs as a JSON array.
+func WriteJSON(w io.Writer, runs []Run) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if runs == nil {
+		runs = []Run{}
+	}
+	return enc.Encode(runs)
+}
+
+// Write one CSV row per job of every run, with the figures of its run.
+func WriteCSV(w io.Writer, runs []Run) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"run", "scheduler", "run_started", "interrupted", "makespan_s", "memcached_core_switches",
+		"latency_samples", "memcached_slo_violations", "job", "threads", "started", "wall_time_s",
+		"paused_time_s", "core_time_s", "work_core_s", "avg_cores", "pauses", "unpauses", "completed",
+	})
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	for _, run := range runs {
+		for _, job := range run.Jobs {
+			cw.Write([]string{
+				run.ID, run.Scheduler, run.Started.Format(time.RFC3339), strconv.FormatBool(run.Interrupted),
+				f(run.Makespan), strconv.Itoa(run.MemcachedSwitches),
+				strconv.Itoa(run.LatencySamples), strconv.Itoa(run.SLOViolations),
+				job.Name, strconv.Itoa(job.Threads), job.Started.Format(time.RFC3339), f(job.WallTime),
+				f(job.PauseTime), f(job.CoreTime), f(job.Work), f(job.Cores), strconv.Itoa(job.Pauses),
+				strconv.Itoa(job.Unpauses), strconv.FormatBool(job.Completed),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Print one line per run.
+func WriteRunTable(w io.Writer, runs []Run) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "run\tscheduler\tjobs\tmakespan [s]\tcore switches\tSLO violations\tinterrupted\t")
+	for _, run := range runs {
+		completed := 0
+		for _, job := range run.Jobs {
+			if job.Completed {
+				completed++
+			}
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v/%v\t%.1f\t%v\t%v/%v\t%v\t\n", run.ID, run.Scheduler,
+			completed, len(run.Jobs), run.Makespan, run.MemcachedSwitches,
+			run.SLOViolations, run.LatencySamples, run.Interrupted)
+	}
+	return tw.Flush()
+}
+
+// Print the statistics of every job.
+func WriteJobTable(w io.Writer, stats []JobStats) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "job\tscheduler\tthreads\truns\tmean wall [s]\tmin [s]\tmax [s]\tmean paused [s]\tmean cores\tmean pauses\t")
+	for _, st := range stats {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%.1f\t%.1f\t%.1f\t%.1f\t%.2f\t%.1f\t\n", st.Job, st.Scheduler,
+			st.Threads, st.Runs, st.MeanWall, st.MinWall, st.MaxWall, st.MeanPause, st.MeanCores, st.Pauses)
+	}
+	return tw.Flush()
+}
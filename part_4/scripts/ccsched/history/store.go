@@ -0,0 +1,221 @@
+// Package history keeps the summary of every run in a file under the state directory, so
+// that the performance of the jobs can be compared across runs and schedulers.
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"ethz.ch/ccsched/controller"
+)
+
+// Layout of run IDs, the start time of the run.
+const idLayout = "20060102-150405"
+
+// A recorded run.
+type Run struct {
+	ID          string    `json:"id"`
+	Scheduler   string    `json:"scheduler"`
+	Started     time.Time `json:"started"`
+	ResultDir   string    `json:"result_dir"`
+	Interrupted bool      `json:"interrupted"`
+	controller.Summary
+}
+
+// Create the record of a run started at the given time.
+func NewRun(scheduler string, started time.Time, resultDir string, summary controller.Summary) Run {
+	return Run{
+		ID:        started.Format(idLayout),
+		Scheduler: scheduler,
+		Started:   started,
+		ResultDir: resultDir,
+		Summary:   summary,
+	}
+}
+
+// Store holds the recorded runs, oldest first. The file is rewritten as a whole on
+// every change, which is cheap at the rate of one run every few minutes.
+type Store struct {
+	file string
+	Runs []Run
+}
+
+// Open the store kept in file, empty if the file does not exist yet.
+func Open(file string) (*Store, error) {
+	s := &Store{file: file}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.Runs); err != nil {
+		return nil, fmt.Errorf("%v: %w", file, err)
+	}
+	return s, nil
+}
+
+// Record a run and save the store. A run with the same ID as an earlier one gets a suffix.
+func (s *Store) Add(run Run) error {
+	id := run.ID
+	for n := 2; s.find(run.ID) >= 0; n++ {
+		run.ID = fmt.Sprintf("%v.%v", id, n)
+	}
+	s.Runs = append(s.Runs, run)
+	return s.save()
+}
+
+func (s *Store) find(id string) int {
+	for i, run := range s.Runs {
+		if run.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// The run with the given ID.
+func (s *Store) Find(id string) (Run, bool) {
+	if i := s.find(id); i >= 0 {
+		return s.Runs[i], true
+	}
+	return Run{}, false
+}
+
+// Write the file atomically, so that an interrupted write loses nothing.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.Runs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.file), 0755); err != nil {
+		return err
+	}
+	tmp := s.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+// The jobs that completed in the recorded runs, interrupted ones included, for the ETA
+// model to learn from. Jobs recorded without their work are left out.
+func (s *Store) JobRuns() []controller.JobRun {
+	var runs []controller.JobRun
+	for _, run := range s.Runs {
+		for _, job := range run.Jobs {
+			if job.Completed && job.Work > 0 {
+				runs = append(runs, controller.JobRun{
+					Job:     job.Name,
+					Threads: job.Threads,
+					Work:    time.Duration(job.Work * float64(time.Second)),
+				})
+			}
+		}
+	}
+	return runs
+}
+
+// Selects the runs to query. Empty fields match everything.
+type Filter struct {
+	Scheduler string
+	Job       string
+	Completed bool // Only the runs of jobs that completed, and runs that were not interrupted.
+}
+
+func (f Filter) matchRun(run Run) bool {
+	return (f.Scheduler == "" || run.Scheduler == f.Scheduler) && !(f.Completed && run.Interrupted)
+}
+
+func (f Filter) matchJob(job controller.JobSummary) bool {
+	return (f.Job == "" || job.Name == f.Job) && !(f.Completed && !job.Completed)
+}
+
+// The runs that match the filter, with only the matching jobs.
+func (s *Store) Query(f Filter) []Run {
+	var runs []Run
+	for _, run := range s.Runs {
+		if !f.matchRun(run) {
+			continue
+		}
+		jobs := make([]controller.JobSummary, 0, len(run.Jobs))
+		for _, job := range run.Jobs {
+			if f.matchJob(job) {
+				jobs = append(jobs, job)
+			}
+		}
+		if f.Job != "" && len(jobs) == 0 {
+			continue
+		}
+		run.Jobs = jobs
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// Statistics of a job over the runs of a scheduler with the same thread count.
+type JobStats struct {
+	Job       string  `json:"job"`
+	Scheduler string  `json:"scheduler"`
+	Threads   int     `json:"threads"`
+	Runs      int     `json:"runs"`
+	MeanWall  float64 `json:"mean_wall_time_s"`
+	MinWall   float64 `json:"min_wall_time_s"`
+	MaxWall   float64 `json:"max_wall_time_s"`
+	MeanPause float64 `json:"mean_paused_time_s"`
+	MeanCores float64 `json:"mean_avg_cores"`
+	Pauses    float64 `json:"mean_pauses"`
+}
+
+// Statistics of every job of the matching runs, sorted by job, scheduler and threads.
+func JobStatsOf(runs []Run) []JobStats {
+	type key struct {
+		job, scheduler string
+		threads        int
+	}
+	stats := make(map[key]*JobStats)
+	for _, run := range runs {
+		for _, job := range run.Jobs {
+			k := key{job.Name, run.Scheduler, job.Threads}
+			st, ok := stats[k]
+			if !ok {
+				st = &JobStats{Job: job.Name, Scheduler: run.Scheduler, Threads: job.Threads,
+					MinWall: math.Inf(1), MaxWall: math.Inf(-1)}
+				stats[k] = st
+			}
+			st.Runs++
+			st.MeanWall += job.WallTime
+			st.MinWall = math.Min(st.MinWall, job.WallTime)
+			st.MaxWall = math.Max(st.MaxWall, job.WallTime)
+			st.MeanPause += job.PauseTime
+			st.MeanCores += job.Cores
+			st.Pauses += float64(job.Pauses)
+		}
+	}
+
+	out := make([]JobStats, 0, len(stats))
+	for _, st := range stats {
+		n := float64(st.Runs)
+		st.MeanWall /= n
+		st.MeanPause /= n
+		st.MeanCores /= n
+		st.Pauses /= n
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Job != out[j].Job {
+			return out[i].Job < out[j].Job
+		}
+		if out[i].Scheduler != out[j].Scheduler {
+			return out[i].Scheduler < out[j].Scheduler
+		}
+		return out[i].Threads < out[j].Threads
+	})
+	return out
+}
@@ -0,0 +1,21 @@
+// Package jobs holds the default job manifest compiled into ccsched, shared by all schedulers.
+// The job tables that the experiments of some policies were run with, <scheduler>.json,
+// are kept next to it for run_scheduler.sh and q5.sh to pass with --jobs.
+package jobs
+
+import (
+	"bytes"
+	_ "embed"
+
+	"ethz.ch/ccsched/controller"
+)
+
+// The PARSEC jobs of part 4.3.
+//
+//go:embed default.json
+var defaultManifest []byte
+
+// The built-in jobs, run by any scheduler unless a manifest is given.
+func Builtin() ([]controller.JobInfo, error) {
+	return controller.ParseJobManifest(bytes.NewReader(defaultManifest))
+}
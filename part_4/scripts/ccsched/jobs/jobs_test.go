@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"ethz.ch/ccsched/controller"
+)
+
+func TestBuiltin(t *testing.T) {
+	jobs, err := Builtin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 6 {
+		t.Errorf("%v built-in jobs, want the 6 PARSEC jobs", len(jobs))
+	}
+}
+
+// The job tables shipped for the scripts must stay valid manifests.
+func TestManifests(t *testing.T) {
+	files, err := filepath.Glob("*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if _, err := controller.LoadJobManifest(file); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package probe
+
+import (
+	"math"
+	"time"
+)
+
+// Latencies are binned on a log scale, with bucketsPerOctave buckets between powers of two
+// of a microsecond, which keeps the relative error of a percentile below 5%.
+const (
+	bucketsPerOctave = 16
+	nbuckets         = 24 * bucketsPerOctave // Up to 2^24 us, about 16s.
+)
+
+// A latency histogram.
+type histogram struct {
+	counts [nbuckets]int
+	total  int
+}
+
+func bucketOf(latency time.Duration) int {
+	us := float64(latency) / float64(time.Microsecond)
+	if us < 1 {
+		return 0
+	}
+	b := int(math.Log2(us) * bucketsPerOctave)
+	if b >= nbuckets {
+		return nbuckets - 1
+	}
+	return b
+}
+
+// Upper bound of the latencies in a bucket.
+func bucketLimit(b int) time.Duration {
+	us := math.Exp2(float64(b+1) / bucketsPerOctave)
+	return time.Duration(us * float64(time.Microsecond))
+}
+
+func (h *histogram) add(latency time.Duration) {
+	h.counts[bucketOf(latency)]++
+	h.total++
+}
+
+func (h *histogram) merge(other *histogram) {
+	for b, n := range other.counts {
+		h.counts[b] += n
+	}
+	h.total += other.total
+}
+
+func (h *histogram) reset() {
+	*h = histogram{}
+}
+
+// The latency below which a fraction q of the samples fall, rounded up to the bucket limit.
+func (h *histogram) quantile(q float64) time.Duration {
+	rank := int(math.Ceil(q * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	seen := 0
+	for b, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			return bucketLimit(b)
+		}
+	}
+	return bucketLimit(nbuckets - 1)
+}
+
+// A histogram of the latencies of the last window, made of slots that expire one at a time.
+type slidingHistogram struct {
+	slots    []histogram
+	slotLen  time.Duration
+	slotTime []time.Time // Start of the period covered by each slot.
+}
+
+func newSlidingHistogram(window time.Duration, nslots int) *slidingHistogram {
+	return &slidingHistogram{
+		slots:    make([]histogram, nslots),
+		slotLen:  window / time.Duration(nslots),
+		slotTime: make([]time.Time, nslots),
+	}
+}
+
+// The slot that covers now, cleared if it last covered an earlier period.
+func (s *slidingHistogram) slot(now time.Time) *histogram {
+	start := now.Truncate(s.slotLen)
+	i := int(start.UnixNano()/int64(s.slotLen)) % len(s.slots)
+	if !s.slotTime[i].Equal(start) {
+		s.slots[i].reset()
+		s.slotTime[i] = start
+	}
+	return &s.slots[i]
+}
+
+func (s *slidingHistogram) add(now time.Time, latency time.Duration) {
+	s.slot(now).add(latency)
+}
+
+// All samples of the window ending at now.
+func (s *slidingHistogram) snapshot(now time.Time) *histogram {
+	var h histogram
+	oldest := now.Truncate(s.slotLen).Add(-time.Duration(len(s.slots)-1) * s.slotLen)
+	for i := range s.slots {
+		if !s.slotTime[i].Before(oldest) && !s.slotTime[i].After(now) {
+			h.merge(&s.slots[i])
+		}
+	}
+	return &h
+}
@@ -0,0 +1,69 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	var h histogram
+	for i := 1; i <= 100; i++ {
+		h.add(time.Duration(i) * time.Millisecond)
+	}
+	for _, test := range []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0.50, 50 * time.Millisecond},
+		{0.95, 95 * time.Millisecond},
+		{0.99, 99 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+	} {
+		got := h.quantile(test.q)
+		if got < test.want || float64(got) > 1.05*float64(test.want) {
+			t.Errorf("quantile(%v) = %v, want %v within 5%%", test.q, got, test.want)
+		}
+	}
+}
+
+func TestHistogramBounds(t *testing.T) {
+	var h histogram
+	h.add(0)
+	if got := h.quantile(0.5); got > time.Microsecond+time.Microsecond/10 {
+		t.Errorf("quantile of 0 = %v, want about 1us", got)
+	}
+	h.reset()
+	h.add(time.Hour)
+	if got, want := h.quantile(0.5), bucketLimit(nbuckets-1); got != want {
+		t.Errorf("quantile of 1h = %v, want the last bucket %v", got, want)
+	}
+}
+
+func TestSlidingHistogram(t *testing.T) {
+	s := newSlidingHistogram(10*time.Second, 10)
+	start := time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	s.add(start, 10*time.Millisecond)
+	s.add(start.Add(5*time.Second), time.Millisecond)
+	if got := s.snapshot(start.Add(5 * time.Second)).total; got != 2 {
+		t.Errorf("%v samples within the window, want 2", got)
+	}
+	if got := s.snapshot(start.Add(5 * time.Second)).quantile(1); got < 10*time.Millisecond {
+		t.Errorf("max of the window = %v, want at least 10ms", got)
+	}
+
+	// The first sample expires once its slot falls out of the window.
+	h := s.snapshot(start.Add(12 * time.Second))
+	if h.total != 1 {
+		t.Fatalf("%v samples within the window, want 1", h.total)
+	}
+	if got := h.quantile(1); got > 2*time.Millisecond {
+		t.Errorf("max of the window = %v, want about 1ms", got)
+	}
+
+	// A slot reused for a later period starts out empty.
+	s.add(start.Add(20*time.Second), 5*time.Millisecond)
+	if got := s.snapshot(start.Add(20 * time.Second)).total; got != 1 {
+		t.Errorf("%v samples within the window, want 1", got)
+	}
+}
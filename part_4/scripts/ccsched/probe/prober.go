@@ -0,0 +1,195 @@
+// Package probe measures the latency of memcached from the scheduler host, with a small
+// rate of requests over the memcached text protocol.
+package probe
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ethz.ch/ccsched/controller"
+)
+
+const (
+	probeKey   = "ccsched-probe"
+	probeValue = "ccsched"
+
+	// Default rate of the requests and how long they are remembered.
+	DefaultInterval = 10 * time.Millisecond
+	DefaultWindow   = 10 * time.Second
+	DefaultTimeout  = 100 * time.Millisecond
+
+	windowSlots = 10 // Granularity at which old samples expire.
+)
+
+// Prober alternates SET and GET requests to memcached and keeps a histogram of their
+// latency over a sliding window. It is a controller.LatencySource.
+type Prober struct {
+	Addr     string        // host:port of memcached.
+	Interval time.Duration // Time between requests.
+	Timeout  time.Duration // Failed requests count as taking this long.
+
+	mu      sync.Mutex
+	hist    *slidingHistogram
+	errors  int
+	conn    net.Conn
+	r       *bufio.Reader
+	failing bool
+}
+
+// Create a prober of the memcached at addr that reports the latencies of the last window.
+func NewProber(addr string, window time.Duration) *Prober {
+	return &Prober{
+		Addr:     addr,
+		Interval: DefaultInterval,
+		Timeout:  DefaultTimeout,
+		hist:     newSlidingHistogram(window, windowSlots),
+	}
+}
+
+// Probe memcached until ctx is done.
+func (p *Prober) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	defer p.disconnect()
+
+	for set := true; ; set = !set {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		p.probe(set)
+	}
+}
+
+// Issue one request and record its latency.
+func (p *Prober) probe(set bool) {
+	latency, err := p.request(set)
+	if err != nil {
+		if !p.failing {
+			log.Printf("Error probing memcached at %v: %v", p.Addr, err)
+		}
+		p.failing = true
+		p.disconnect()
+		latency = p.Timeout
+	} else if p.failing {
+		log.Printf("Probing memcached at %v again", p.Addr)
+		p.failing = false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hist.add(time.Now(), latency)
+	if err != nil {
+		p.errors++
+	}
+}
+
+func (p *Prober) request(set bool) (time.Duration, error) {
+	if p.conn == nil {
+		conn, err := net.DialTimeout("tcp", p.Addr, p.Timeout)
+		if err != nil {
+			return 0, err
+		}
+		p.conn = conn
+		p.r = bufio.NewReader(conn)
+	}
+
+	start := time.Now()
+	if err := p.conn.SetDeadline(start.Add(p.Timeout)); err != nil {
+		return 0, err
+	}
+	var err error
+	if set {
+		err = p.set()
+	} else {
+		err = p.get()
+	}
+	return time.Since(start), err
+}
+
+func (p *Prober) set() error {
+	if _, err := fmt.Fprintf(p.conn, "set %v 0 0 %v\r\n%v\r\n", probeKey, len(probeValue), probeValue); err != nil {
+		return err
+	}
+	reply, err := p.readLine()
+	if err != nil {
+		return err
+	}
+	if reply != "STORED" {
+		return fmt.Errorf("set: unexpected reply %q", reply)
+	}
+	return nil
+}
+
+func (p *Prober) get() error {
+	if _, err := fmt.Fprintf(p.conn, "get %v\r\n", probeKey); err != nil {
+		return err
+	}
+	for {
+		reply, err := p.readLine()
+		if err != nil {
+			return err
+		}
+		if reply == "END" {
+			return nil
+		}
+		// VALUE <key> <flags> <bytes>, followed by the data.
+		fields := strings.Fields(reply)
+		if len(fields) < 4 || fields[0] != "VALUE" {
+			return fmt.Errorf("get: unexpected reply %q", reply)
+		}
+		n, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return fmt.Errorf("get: unexpected reply %q", reply)
+		}
+		if _, err := p.r.Discard(n + 2); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *Prober) readLine() (string, error) {
+	line, err := p.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (p *Prober) disconnect() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+		p.r = nil
+	}
+}
+
+// Latency percentiles of the requests of the last window, failed ones included.
+func (p *Prober) Percentiles() (controller.LatencyStats, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h := p.hist.snapshot(time.Now())
+	if h.total == 0 {
+		return controller.LatencyStats{}, controller.ErrNoLatency
+	}
+	return controller.LatencyStats{
+		P50: h.quantile(0.50),
+		P95: h.quantile(0.95),
+		P99: h.quantile(0.99),
+	}, nil
+}
+
+// Number of failed requests so far.
+func (p *Prober) Errors() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.errors
+}
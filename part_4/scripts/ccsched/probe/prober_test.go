@@ -0,0 +1,121 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"ethz.ch/ccsched/controller"
+	"ethz.ch/ccsched/fake"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// Probe addr for a while, at a high rate to collect enough samples.
+func runProber(t *testing.T, addr string, d time.Duration) *Prober {
+	t.Helper()
+	p := NewProber(addr, DefaultWindow)
+	p.Interval = time.Millisecond
+	p.Timeout = 50 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("run: %v", err)
+		}
+	case <-time.After(d + 5*time.Second):
+		t.Fatal("prober did not stop with its context")
+	}
+	return p
+}
+
+func newServer(t *testing.T) *fake.MemcachedServer {
+	t.Helper()
+	server, err := fake.NewMemcachedServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func TestProber(t *testing.T) {
+	p := NewProber("127.0.0.1:1", DefaultWindow)
+	if _, err := p.Percentiles(); !errors.Is(err, controller.ErrNoLatency) {
+		t.Errorf("percentiles before probing: %v, want %v", err, controller.ErrNoLatency)
+	}
+
+	server := newServer(t)
+	p = runProber(t, server.Addr(), 200*time.Millisecond)
+	if n := p.Errors(); n != 0 {
+		t.Errorf("%v failed requests, want none", n)
+	}
+	stats, err := p.Percentiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.P50 > stats.P95 || stats.P95 > stats.P99 {
+		t.Errorf("percentiles out of order: %+v", stats)
+	}
+	if stats.P95 >= p.Timeout {
+		t.Errorf("p95 %v of a fast server, want below the timeout %v", stats.P95, p.Timeout)
+	}
+}
+
+func TestProberDelay(t *testing.T) {
+	const delay = 5 * time.Millisecond
+	server := newServer(t)
+	server.Delay = func() time.Duration { return delay }
+
+	p := runProber(t, server.Addr(), 200*time.Millisecond)
+	if n := p.Errors(); n != 0 {
+		t.Errorf("%v failed requests, want none", n)
+	}
+	stats, err := p.Percentiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.P95 < delay {
+		t.Errorf("p95 %v, want at least the server delay %v", stats.P95, delay)
+	}
+}
+
+func TestProberDown(t *testing.T) {
+	server := newServer(t)
+	addr := server.Addr()
+	server.Close()
+
+	p := runProber(t, addr, 100*time.Millisecond)
+	if p.Errors() == 0 {
+		t.Error("no failed requests to a server that is down")
+	}
+	stats, err := p.Percentiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.P50 < p.Timeout {
+		t.Errorf("p50 %v, want failed requests to count as the timeout %v", stats.P50, p.Timeout)
+	}
+}
+
+// A server that stops replying does not stall the prober beyond its timeout.
+func TestProberHung(t *testing.T) {
+	server := newServer(t)
+	server.Delay = func() time.Duration { return time.Hour }
+
+	p := runProber(t, server.Addr(), 200*time.Millisecond)
+	if p.Errors() == 0 {
+		t.Error("no failed requests to a server that never replies")
+	}
+}
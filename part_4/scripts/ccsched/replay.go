@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ethz.ch/ccsched/controller"
+	"ethz.ch/ccsched/fake"
+	"ethz.ch/ccsched/replay"
+	"ethz.ch/ccsched/sim"
+)
+
+func replayUsage(fs *flag.FlagSet) func() {
+	return func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: ccsched replay ingest [-o <dir>] <run-dir>...")
+		fmt.Fprintln(out, "       ccsched [--scheduler <name>] [--jobs <manifest.json>] replay run [flags] <trace.json|run-dir> <result-dir>")
+		fs.PrintDefaults()
+	}
+}
+
+// Name of the trace of a result directory, e.g. question_4_2_5_qpsi_2.json.
+func traceName(runDir string) string {
+	dir, err := filepath.Abs(runDir)
+	if err != nil {
+		dir = runDir
+	}
+	return filepath.Base(filepath.Dir(dir)) + "_" + filepath.Base(dir) + ".json"
+}
+
+// Turn recorded runs into traces, or replay one against the scheduler.
+func runReplay(ctx context.Context, run runFlags, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	outDir := fs.String("o", ".", "directory of the traces, for ingest")
+	specFile := fs.String("spec", "", "JSON run times of the jobs per core count (default: the PARSEC jobs of part 2b)")
+	qpsPerCore := fs.Float64("qps-per-core", sim.DefaultQpsPerCore, "memcached throughput that keeps one core busy")
+	tolerance := fs.Duration("tolerance", 2*time.Second, "shortest divergence to report")
+	maxDivergences := fs.Int("max-divergences", 20, "divergences to print, all are in divergence.json")
+	fs.Usage = replayUsage(fs)
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	cmd := args[0]
+	fs.Parse(args[1:])
+
+	switch cmd {
+	case "ingest":
+		if fs.NArg() == 0 {
+			return errors.New("replay ingest needs result directories")
+		}
+		if err := os.MkdirAll(*outDir, 0755); err != nil {
+			return err
+		}
+		for _, dir := range fs.Args() {
+			t, err := replay.Ingest(dir)
+			if err != nil {
+				return err
+			}
+			file := path.Join(*outDir, traceName(dir))
+			if err := t.Save(file); err != nil {
+				return err
+			}
+			fmt.Printf("%v: %v samples, %v decisions of %v over %v\n",
+				file, len(t.Samples), len(t.Decisions), t.Scheduler, t.Duration())
+		}
+		return nil
+
+	case "run":
+		if fs.NArg() != 2 {
+			return errors.New("replay run needs a trace or result directory, and a result directory")
+		}
+		source, resultDir := fs.Arg(0), fs.Arg(1)
+		var t *replay.Trace
+		var err error
+		if replay.IsTraceFile(source) {
+			t, err = replay.Load(source)
+		} else {
+			t, err = replay.Ingest(source)
+		}
+		if err != nil {
+			return err
+		}
+		specs := sim.ParsecSpec()
+		if *specFile != "" {
+			if specs, err = sim.LoadSpec(*specFile); err != nil {
+				return err
+			}
+		}
+		cfg := sim.Config{
+			Cpus:         t.Cpus,
+			Reserved:     run.reserved,
+			Load:         t.Load(*qpsPerCore),
+			Specs:        specs,
+			Pressure:     run.psiMode != "",
+			PressureOnly: run.psiMode == "only",
+		}
+		var sampler *replay.Sampler
+		var memcachedCpus int
+		err = simulate(ctx, run, cfg, resultDir, func(env *fake.Env, cli *controller.Controller) {
+			sampler = &replay.Sampler{Trace: t, Env: env}
+			cli.Sampler = sampler
+			memcachedCpus = len(cli.ReservedCpus())
+		})
+		if err != nil {
+			return err
+		}
+		if !sampler.Done() {
+			fmt.Println("The run ended before the end of the recording")
+		}
+
+		events, err := replay.ReadEvents(path.Join(resultDir, "events.jsonl"))
+		if err != nil {
+			return err
+		}
+		report := replay.Compare(t, run.schedName, replay.FromEvents(events, fake.Epoch), memcachedCpus, *tolerance)
+		if err := report.Write(path.Join(resultDir, "divergence.json")); err != nil {
+			return err
+		}
+		var text strings.Builder
+		report.WriteTable(&text, *maxDivergences)
+		fmt.Print("\n", text.String())
+		return os.WriteFile(path.Join(resultDir, "divergence.txt"), []byte(text.String()), 0644)
+	}
+	return fmt.Errorf("unknown replay command %q", cmd)
+}
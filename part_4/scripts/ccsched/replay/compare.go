@@ -0,0 +1,281 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"ethz.ch/ccsched/controller"
+)
+
+// Read the events of an event log file.
+func ReadEvents(file string) ([]controller.Event, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var events []controller.Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var ev controller.Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("%v: %w", file, err)
+		}
+		events = append(events, ev)
+	}
+	return events, scanner.Err()
+}
+
+// The decisions among the events of a run started at the given time.
+func FromEvents(events []controller.Event, start time.Time) []Decision {
+	var decisions []Decision
+	for _, ev := range events {
+		switch ev.Type {
+		case controller.EventJobStarted, controller.EventJobPaused, controller.EventJobUnpaused,
+			controller.EventJobCompleted, controller.EventJobCpuset, controller.EventMemcachedCpus:
+			decisions = append(decisions, Decision{
+				TimeMs: ev.TimestampMs - start.UnixNano()/1e6,
+				Type:   ev.Type,
+				Job:    ev.Job,
+				Cpuset: ev.Cpuset,
+			})
+		}
+	}
+	return decisions
+}
+
+// What the scheduler has decided at some point in time.
+type state struct {
+	memcached int    // Cpus of memcached.
+	running   string // Running jobs, sorted and comma-separated.
+}
+
+type change struct {
+	at time.Duration
+	state
+}
+
+// The states over time, starting with memcached on memcachedCpus and nothing running.
+func timeline(decisions []Decision, memcachedCpus int) []change {
+	running := make(map[string]bool)
+	cur := change{state: state{memcached: memcachedCpus}}
+	changes := []change{cur}
+	for _, d := range decisions {
+		switch d.Type {
+		case controller.EventMemcachedCpus:
+			cur.memcached = len(d.Cpuset)
+		case controller.EventJobStarted, controller.EventJobUnpaused:
+			running[d.Job] = true
+		case controller.EventJobPaused, controller.EventJobCompleted:
+			delete(running, d.Job)
+		default:
+			continue
+		}
+		jobs := make([]string, 0, len(running))
+		for job := range running {
+			jobs = append(jobs, job)
+		}
+		sort.Strings(jobs)
+		cur.at = d.at()
+		cur.running = strings.Join(jobs, ",")
+		if last := &changes[len(changes)-1]; last.at == cur.at {
+			*last = cur
+		} else {
+			changes = append(changes, cur)
+		}
+	}
+	return changes
+}
+
+// The state at a time.
+func stateAt(changes []change, at time.Duration) state {
+	i := sort.Search(len(changes), func(i int) bool { return changes[i].at > at })
+	return changes[i-1].state
+}
+
+// A period during which the candidate decided differently from the recorded scheduler.
+type Divergence struct {
+	Start     float64 `json:"start_s"` // Since the start of the run.
+	End       float64 `json:"end_s"`
+	What      string  `json:"what"` // memcached_cpus or running_jobs.
+	Recorded  string  `json:"recorded"`
+	Candidate string  `json:"candidate"`
+}
+
+// How a job fared in both runs. Times are since the start of the run, -1 if it never happened.
+type JobDiff struct {
+	Job                string  `json:"job"`
+	RecordedStart      float64 `json:"recorded_start_s"`
+	CandidateStart     float64 `json:"candidate_start_s"`
+	RecordedCompleted  float64 `json:"recorded_completed_s"`
+	CandidateCompleted float64 `json:"candidate_completed_s"`
+	RecordedPauses     int     `json:"recorded_pauses"`
+	CandidatePauses    int     `json:"candidate_pauses"`
+}
+
+// Report of the divergences of a candidate scheduler over the length of the recorded run.
+type Report struct {
+	Source             string       `json:"source"`
+	Recorded           string       `json:"recorded_scheduler"`
+	Candidate          string       `json:"candidate_scheduler"`
+	Duration           float64      `json:"duration_s"`
+	MemcachedAgreement float64      `json:"memcached_agreement_pct"` // Time with as many memcached cpus in both runs.
+	Divergences        []Divergence `json:"divergences"`
+	Jobs               []JobDiff    `json:"jobs"`
+}
+
+// Compare the decisions of a candidate with those of the recorded run. Both runs start
+// with memcached on memcachedCpus. Divergences shorter than tolerance are left out, as the
+// recorded times are only accurate to the second.
+func Compare(t *Trace, candidate string, decisions []Decision, memcachedCpus int, tolerance time.Duration) Report {
+	r := Report{Source: t.Source, Recorded: t.Scheduler, Candidate: candidate}
+	end := t.Duration()
+	r.Duration = end.Seconds()
+	rec := timeline(t.Decisions, memcachedCpus)
+	cand := timeline(decisions, memcachedCpus)
+
+	// Instants at which either run changes its mind.
+	var times []time.Duration
+	for _, c := range append(append([]change(nil), rec...), cand...) {
+		if c.at < end {
+			times = append(times, c.at)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	var agree time.Duration
+	open := make(map[string]*Divergence) // Divergences still going on, by what.
+	closeDiv := func(what string, at time.Duration) {
+		if d := open[what]; d != nil {
+			d.End = at.Seconds()
+			if d.End-d.Start >= tolerance.Seconds() {
+				r.Divergences = append(r.Divergences, *d)
+			}
+			delete(open, what)
+		}
+	}
+	diverge := func(what string, at time.Duration, recorded, candidate string) {
+		if d := open[what]; d != nil && d.Recorded == recorded && d.Candidate == candidate {
+			return
+		}
+		closeDiv(what, at)
+		open[what] = &Divergence{Start: at.Seconds(), What: what, Recorded: recorded, Candidate: candidate}
+	}
+	for i, at := range times {
+		next := end
+		if i+1 < len(times) {
+			next = times[i+1]
+		}
+		if next == at {
+			continue
+		}
+		r1, c1 := stateAt(rec, at), stateAt(cand, at)
+		if r1.memcached == c1.memcached {
+			agree += next - at
+			closeDiv("memcached_cpus", at)
+		} else {
+			diverge("memcached_cpus", at, fmt.Sprint(r1.memcached), fmt.Sprint(c1.memcached))
+		}
+		if r1.running == c1.running {
+			closeDiv("running_jobs", at)
+		} else {
+			diverge("running_jobs", at, r1.running, c1.running)
+		}
+	}
+	closeDiv("memcached_cpus", end)
+	closeDiv("running_jobs", end)
+	sort.SliceStable(r.Divergences, func(i, j int) bool { return r.Divergences[i].Start < r.Divergences[j].Start })
+	if end > 0 {
+		r.MemcachedAgreement = 100 * float64(agree) / float64(end)
+	}
+
+	r.Jobs = jobDiffs(t.Decisions, decisions)
+	return r
+}
+
+func jobDiffs(recorded, candidate []Decision) []JobDiff {
+	var jobs []string
+	diffs := make(map[string]*JobDiff)
+	get := func(job string) *JobDiff {
+		d, ok := diffs[job]
+		if !ok {
+			d = &JobDiff{Job: job, RecordedStart: -1, CandidateStart: -1, RecordedCompleted: -1, CandidateCompleted: -1}
+			diffs[job] = d
+			jobs = append(jobs, job)
+		}
+		return d
+	}
+	for _, d := range recorded {
+		switch d.Type {
+		case controller.EventJobStarted:
+			get(d.Job).RecordedStart = d.at().Seconds()
+		case controller.EventJobCompleted:
+			get(d.Job).RecordedCompleted = d.at().Seconds()
+		case controller.EventJobPaused:
+			get(d.Job).RecordedPauses++
+		}
+	}
+	for _, d := range candidate {
+		switch d.Type {
+		case controller.EventJobStarted:
+			get(d.Job).CandidateStart = d.at().Seconds()
+		case controller.EventJobCompleted:
+			get(d.Job).CandidateCompleted = d.at().Seconds()
+		case controller.EventJobPaused:
+			get(d.Job).CandidatePauses++
+		}
+	}
+	out := make([]JobDiff, len(jobs))
+	for i, job := range jobs {
+		out[i] = *diffs[job]
+	}
+	return out
+}
+
+// Write the report as JSON to a file.
+func (r Report) Write(file string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+func formatTime(s float64) string {
+	if s < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f", s)
+}
+
+// Print the report as text, with at most maxDivergences divergences.
+func (r Report) WriteTable(w io.Writer, maxDivergences int) {
+	fmt.Fprintf(w, "replay of %v: recorded %v, candidate %v\n", r.Source, r.Recorded, r.Candidate)
+	fmt.Fprintf(w, "memcached cpus agree %.1f%% of %.0f s, %v divergences\n", r.MemcachedAgreement, r.Duration, len(r.Divergences))
+	if len(r.Divergences) > 0 {
+		d := r.Divergences[0]
+		fmt.Fprintf(w, "first divergence at %.0f s: %v recorded %q, candidate %q\n", d.Start, d.What, d.Recorded, d.Candidate)
+		fmt.Fprintf(w, "\n%8v %8v  %-14v  %-30v  %v\n", "from [s]", "to [s]", "what", "recorded", "candidate")
+		for i, d := range r.Divergences {
+			if i == maxDivergences {
+				fmt.Fprintf(w, "... %v more\n", len(r.Divergences)-i)
+				break
+			}
+			fmt.Fprintf(w, "%8.0f %8.0f  %-14v  %-30v  %v\n", d.Start, d.End, d.What, d.Recorded, d.Candidate)
+		}
+	}
+	fmt.Fprintf(w, "\n%14v  %19v  %19v  %13v\n", "job", "started rec/cand", "completed rec/cand", "pauses rec/cand")
+	for _, j := range r.Jobs {
+		fmt.Fprintf(w, "%14v  %9v/%-9v  %9v/%-9v  %6v/%-6v\n", j.Job,
+			formatTime(j.RecordedStart), formatTime(j.CandidateStart),
+			formatTime(j.RecordedCompleted), formatTime(j.CandidateCompleted),
+			j.RecordedPauses, j.CandidatePauses)
+	}
+}
@@ -0,0 +1,156 @@
+package replay
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"ethz.ch/ccsched/controller"
+	"ethz.ch/ccsched/scheduler"
+	"ethz.ch/ccsched/sim"
+)
+
+// Layout of the timestamps of the scheduler log, in UTC on the measurement hosts.
+const logTimeLayout = "2006/01/02 15:04:05"
+
+var (
+	logLinePattern   = regexp.MustCompile(`^(\d{4}/\d\d/\d\d \d\d:\d\d:\d\d) (.*)$`)
+	usagePattern     = regexp.MustCompile(`^cpu usage:  \[(.*)\]$`)
+	schedPattern     = regexp.MustCompile(`^Running with scheduler (?:(\S+) \()?\*scheduler\.(\w+)\)?$`)
+	memcachedPattern = regexp.MustCompile(`^memcached running on cpu ([\d,]+)$`)
+	jobCpusPattern   = regexp.MustCompile(`^Job (\S+) running on cpu ([\d,]+)$`)
+	jobStatePattern  = regexp.MustCompile(`^(Started|Paused|Unpaused|Completed) job (\S+)$`)
+)
+
+// Decisions logged as "<State> job <name>".
+var jobStateEvents = map[string]string{
+	"Started":   controller.EventJobStarted,
+	"Paused":    controller.EventJobPaused,
+	"Unpaused":  controller.EventJobUnpaused,
+	"Completed": controller.EventJobCompleted,
+}
+
+// The registered name of a scheduler logged by its type, e.g. mc1large for
+// MC1LargeScheduler, or the type if no scheduler has it.
+func schedulerName(typeName string) string {
+	for _, info := range scheduler.List() {
+		if sched, err := scheduler.New(info.Name); err == nil && fmt.Sprintf("%T", sched) == "*scheduler."+typeName {
+			return info.Name
+		}
+	}
+	return typeName
+}
+
+// Read the cpu usage samples and decisions of a scheduler log. The log has one-second
+// timestamps, so the samples logged within a second are spread evenly over it.
+func ParseSchedulerLog(r io.Reader) (*Trace, error) {
+	t := &Trace{}
+	var second []Sample // Samples logged in the current second.
+	var secondMs int64
+	flush := func() {
+		for i := range second {
+			second[i].TimeMs = secondMs + int64(i)*1000/int64(len(second))
+		}
+		t.Samples = append(t.Samples, second...)
+		second = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m := logLinePattern.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		at, err := time.Parse(logTimeLayout, m[1])
+		if err != nil {
+			continue
+		}
+		if t.Start.IsZero() {
+			t.Start = at
+		}
+		ms := at.Sub(t.Start).Milliseconds()
+		if ms != secondMs {
+			flush()
+			secondMs = ms
+		}
+		msg := m[2]
+
+		if m := usagePattern.FindStringSubmatch(msg); m != nil {
+			var usage []float64
+			for _, field := range strings.Fields(m[1]) {
+				u, err := strconv.ParseFloat(field, 64)
+				if err != nil {
+					return nil, fmt.Errorf("cpu usage at %v: %w", at, err)
+				}
+				usage = append(usage, u)
+			}
+			if len(usage) > t.Cpus {
+				t.Cpus = len(usage)
+			}
+			second = append(second, Sample{Usage: usage})
+		} else if m := schedPattern.FindStringSubmatch(msg); m != nil {
+			t.Scheduler = m[1]
+			if t.Scheduler == "" {
+				t.Scheduler = schedulerName(m[2])
+			}
+		} else if m := memcachedPattern.FindStringSubmatch(msg); m != nil {
+			cpus, err := controller.ParseCpuList(m[1])
+			if err != nil {
+				return nil, err
+			}
+			t.Decisions = append(t.Decisions, Decision{TimeMs: ms, Type: controller.EventMemcachedCpus, Cpuset: cpus})
+		} else if m := jobCpusPattern.FindStringSubmatch(msg); m != nil {
+			cpus, err := controller.ParseCpuList(m[2])
+			if err != nil {
+				return nil, err
+			}
+			t.Decisions = append(t.Decisions, Decision{TimeMs: ms, Type: controller.EventJobCpuset, Job: m[1], Cpuset: cpus})
+		} else if m := jobStatePattern.FindStringSubmatch(msg); m != nil {
+			t.Decisions = append(t.Decisions, Decision{TimeMs: ms, Type: jobStateEvents[m[1]], Job: m[2]})
+		}
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(t.Samples) == 0 {
+		return nil, errors.New("no cpu usage samples found")
+	}
+	return t, nil
+}
+
+// Build the trace of a result directory from its scheduler.log and, if there is one,
+// the QPS schedule of its latencies.raw.
+func Ingest(dir string) (*Trace, error) {
+	logFile := path.Join(dir, "scheduler.log")
+	f, err := os.Open(logFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t, err := ParseSchedulerLog(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", logFile, err)
+	}
+	t.Source = dir
+
+	qps, err := sim.LoadQpsTrace(path.Join(dir, "latencies.raw"), 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	} else if err != nil {
+		return nil, err
+	}
+	t.QpsIntervalMs = qps.Interval.Milliseconds()
+	t.Qps = qps.Qps
+	if !qps.Start.IsZero() && t.Start.After(qps.Start) {
+		t.QpsOffsetMs = t.Start.Sub(qps.Start).Milliseconds()
+	}
+	return t, nil
+}
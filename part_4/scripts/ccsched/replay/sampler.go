@@ -0,0 +1,41 @@
+package replay
+
+import (
+	"time"
+
+	"ethz.ch/ccsched/fake"
+)
+
+// Sampler replays the recorded cpu usage, whatever the candidate scheduler does, and moves
+// the simulated host along to the time of every sample so that its jobs progress.
+// Once the recording runs out, the simulated host takes over to let the jobs finish.
+type Sampler struct {
+	Trace *Trace
+	Env   *fake.Env
+
+	next int
+}
+
+// Whether the recorded samples have all been replayed.
+func (s *Sampler) Done() bool {
+	return s.next >= len(s.Trace.Samples)
+}
+
+func (s *Sampler) Percent(interval time.Duration) ([]float64, error) {
+	if s.Done() {
+		return s.Env.Sampler.Percent(interval)
+	}
+	sample := s.Trace.Samples[s.next]
+	s.next++
+	elapsed := s.Env.Runtime.Now().Sub(fake.Epoch)
+	step := time.Duration(sample.TimeMs)*time.Millisecond - elapsed
+	if step < 0 {
+		step = 0
+	}
+	if _, err := s.Env.Sampler.Percent(step); err != nil {
+		return nil, err
+	}
+	usage := make([]float64, s.Env.Sampler.Ncpu)
+	copy(usage, sample.Usage)
+	return usage, nil
+}
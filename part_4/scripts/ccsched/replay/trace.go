@@ -0,0 +1,105 @@
+// Package replay turns recorded runs into traces, feeds their cpu usage and memcached load
+// to a candidate scheduler on a simulated host, and reports where its decisions diverge
+// from the recorded ones.
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"ethz.ch/ccsched/controller"
+	"ethz.ch/ccsched/sim"
+)
+
+// A cpu usage sample of the recorded run.
+type Sample struct {
+	TimeMs int64     `json:"t_ms"` // Since the start of the run.
+	Usage  []float64 `json:"usage"`
+}
+
+// A scheduling decision: an event of type job_started, job_paused, job_unpaused,
+// job_completed, job_cpuset or memcached_cpuset.
+type Decision struct {
+	TimeMs int64              `json:"t_ms"` // Since the start of the run.
+	Type   string             `json:"type"`
+	Job    string             `json:"job,omitempty"`
+	Cpuset controller.CpuList `json:"cpuset,omitempty"`
+}
+
+func (d Decision) at() time.Duration {
+	return time.Duration(d.TimeMs) * time.Millisecond
+}
+
+// Trace of a recorded run, as stored in a JSON file.
+type Trace struct {
+	Source    string     `json:"source"`    // Result directory of the run.
+	Scheduler string     `json:"scheduler"` // Name of the recorded scheduler, if known.
+	Start     time.Time  `json:"start"`
+	Cpus      int        `json:"cpus"`
+	Samples   []Sample   `json:"samples"`
+	Decisions []Decision `json:"decisions"`
+
+	// QPS schedule of memcached, empty if there was no mcperf output.
+	QpsIntervalMs int64     `json:"qps_interval_ms,omitempty"`
+	QpsOffsetMs   int64     `json:"qps_offset_ms,omitempty"` // Time into the schedule at the start of the run.
+	Qps           []float64 `json:"qps,omitempty"`
+}
+
+// Length of the recorded run, up to the last sample or decision.
+func (t *Trace) Duration() time.Duration {
+	var end int64
+	if n := len(t.Samples); n > 0 {
+		end = t.Samples[n-1].TimeMs
+	}
+	if n := len(t.Decisions); n > 0 && t.Decisions[n-1].TimeMs > end {
+		end = t.Decisions[n-1].TimeMs
+	}
+	return time.Duration(end) * time.Millisecond
+}
+
+// The memcached load of the run, in percent of a single core at a time since its start,
+// nil without a QPS schedule.
+func (t *Trace) Load(qpsPerCore float64) func(time.Duration) float64 {
+	if len(t.Qps) == 0 {
+		return nil
+	}
+	qps := &sim.QpsTrace{Interval: time.Duration(t.QpsIntervalMs) * time.Millisecond, Qps: t.Qps}
+	load := qps.Load(qpsPerCore)
+	offset := time.Duration(t.QpsOffsetMs) * time.Millisecond
+	return func(since time.Duration) float64 {
+		return load(since + offset)
+	}
+}
+
+// Load a trace file.
+func Load(file string) (*Trace, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var t Trace
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("%v: %w", file, err)
+	}
+	if t.Cpus == 0 || len(t.Samples) == 0 {
+		return nil, fmt.Errorf("%v: no cpu samples", file)
+	}
+	return &t, nil
+}
+
+// Save the trace to a file.
+func (t *Trace) Save(file string) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// Is file a trace rather than a result directory.
+func IsTraceFile(file string) bool {
+	info, err := os.Stat(file)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"ethz.ch/ccsched/controller"
+)
+
+// Owner of the cpus of memcached in a CpuAllocator.
+const memcachedOwner = "memcached"
+
+var (
+	ErrCpuBusy    = errors.New("cpu already allocated")
+	ErrCpuOffline = errors.New("cpu not online")
+)
+
+// CpuAllocator owns the assignment of cpus to memcached and the jobs. Every cpu has at
+// most one owner: assignments that would overlap are rejected as a whole.
+type CpuAllocator struct {
+	online map[int]bool
+	owner  map[int]string                // Owner of every allocated cpu.
+	cpus   map[string]controller.CpuList // Cpus of every owner.
+}
+
+func NewCpuAllocator(online controller.CpuList) *CpuAllocator {
+	a := &CpuAllocator{
+		online: make(map[int]bool, len(online)),
+		owner:  make(map[int]string),
+		cpus:   make(map[string]controller.CpuList),
+	}
+	for _, cpu := range online {
+		a.online[cpu] = true
+	}
+	return a
+}
+
+// Give more cpus to an owner.
+func (a *CpuAllocator) Allocate(owner string, cpus controller.CpuList) error {
+	if err := a.check(owner, cpus); err != nil {
+		return err
+	}
+	for _, cpu := range cpus {
+		if a.owner[cpu] != owner {
+			a.owner[cpu] = owner
+			a.cpus[owner] = append(a.cpus[owner], cpu)
+		}
+	}
+	return nil
+}
+
+// Replace the cpus of an owner. The owner keeps its cpus if the new ones are not free.
+func (a *CpuAllocator) Resize(owner string, cpus controller.CpuList) error {
+	if err := a.check(owner, cpus); err != nil {
+		return err
+	}
+	a.Release(owner)
+	return a.Allocate(owner, cpus)
+}
+
+// Free all cpus of an owner and return them.
+func (a *CpuAllocator) Release(owner string) controller.CpuList {
+	cpus := a.cpus[owner]
+	for _, cpu := range cpus {
+		delete(a.owner, cpu)
+	}
+	delete(a.cpus, owner)
+	return cpus
+}
+
+func (a *CpuAllocator) check(owner string, cpus controller.CpuList) error {
+	for _, cpu := range cpus {
+		if !a.online[cpu] {
+			return fmt.Errorf("allocate cpu %v to %v: %w", cpu, owner, ErrCpuOffline)
+		}
+		if other, ok := a.owner[cpu]; ok && other != owner {
+			return fmt.Errorf("allocate cpu %v to %v: %w to %v", cpu, owner, ErrCpuBusy, other)
+		}
+	}
+	return nil
+}
+
+// The cpus of an owner.
+func (a *CpuAllocator) Cpus(owner string) controller.CpuList {
+	return a.cpus[owner]
+}
+
+// The owner of a cpu, empty if it is free.
+func (a *CpuAllocator) Owner(cpu int) string {
+	return a.owner[cpu]
+}
+
+// The free ones among cpus, in the same order.
+func (a *CpuAllocator) Free(cpus controller.CpuList) controller.CpuList {
+	var free controller.CpuList
+	for _, cpu := range cpus {
+		if _, ok := a.owner[cpu]; !ok {
+			free = append(free, cpu)
+		}
+	}
+	return free
+}
+
+// The owners of any of the cpus, sorted by name.
+func (a *CpuAllocator) Owners(cpus controller.CpuList) []string {
+	set := make(map[string]bool)
+	for _, cpu := range cpus {
+		if owner, ok := a.owner[cpu]; ok {
+			set[owner] = true
+		}
+	}
+	owners := jobNames(set)
+	sort.Strings(owners)
+	return owners
+}
@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"ethz.ch/ccsched/controller"
+)
+
+func TestCpuAllocator(t *testing.T) {
+	a := NewCpuAllocator(controller.CpuList{0, 1, 2, 3})
+	if err := a.Allocate(memcachedOwner, controller.CpuList{0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Allocate("ferret", controller.CpuList{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Overlapping assignments are rejected as a whole.
+	if err := a.Allocate("dedup", controller.CpuList{3}); !errors.Is(err, ErrCpuBusy) {
+		t.Errorf("allocate a busy cpu: %v, want %v", err, ErrCpuBusy)
+	}
+	if err := a.Resize(memcachedOwner, controller.CpuList{0, 2}); !errors.Is(err, ErrCpuBusy) {
+		t.Errorf("resize onto a busy cpu: %v, want %v", err, ErrCpuBusy)
+	}
+	if got, want := a.Cpus(memcachedOwner), (controller.CpuList{0, 1}); !reflect.DeepEqual(got, want) {
+		t.Errorf("memcached has cpus %v after a failed resize, want %v", got, want)
+	}
+	if got := a.Cpus("dedup"); len(got) != 0 {
+		t.Errorf("dedup has cpus %v after a failed allocation", got)
+	}
+
+	// Offline cpus are never handed out.
+	if err := a.Allocate("dedup", controller.CpuList{4}); !errors.Is(err, ErrCpuOffline) {
+		t.Errorf("allocate an offline cpu: %v, want %v", err, ErrCpuOffline)
+	}
+	if err := a.Resize("ferret", controller.CpuList{2, 7}); !errors.Is(err, ErrCpuOffline) {
+		t.Errorf("resize onto an offline cpu: %v, want %v", err, ErrCpuOffline)
+	}
+	if got, want := a.Cpus("ferret"), (controller.CpuList{2, 3}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ferret has cpus %v after a failed resize, want %v", got, want)
+	}
+
+	// An owner may resize within its own cpus and onto free ones.
+	if err := a.Resize(memcachedOwner, controller.CpuList{0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Resize("ferret", controller.CpuList{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := a.Owners(controller.CpuList{0, 1, 2, 3}), []string{"ferret", memcachedOwner}; !reflect.DeepEqual(got, want) {
+		t.Errorf("owners %v, want %v", got, want)
+	}
+	if got := a.Free(controller.CpuList{0, 1, 2, 3}); len(got) != 0 {
+		t.Errorf("free cpus %v, want none", got)
+	}
+
+	// Released cpus are free again.
+	if got, want := a.Release("ferret"), (controller.CpuList{1, 2, 3}); !reflect.DeepEqual(got, want) {
+		t.Errorf("released %v, want %v", got, want)
+	}
+	if got, want := a.Free(controller.CpuList{3, 2, 1, 0}), (controller.CpuList{3, 2, 1}); !reflect.DeepEqual(got, want) {
+		t.Errorf("free cpus %v, want %v", got, want)
+	}
+	if owner := a.Owner(2); owner != "" {
+		t.Errorf("cpu 2 still owned by %v", owner)
+	}
+}
@@ -0,0 +1,175 @@
+package scheduler
+
+import (
+	"errors"
+	"sort"
+
+	"ethz.ch/ccsched/controller"
+)
+
+// How the cpus are split between memcached and the jobs.
+type cpuLayout struct {
+	topo     *controller.Topology
+	policy   controller.PlacementPolicy
+	reserved controller.CpuList // memcached runs on all of them, or on the first one only.
+	batch    controller.CpuList // Only for jobs.
+	lendable controller.CpuList // Reserved cpus that jobs may use while memcached runs on one core.
+}
+
+func newCpuLayout(cli *controller.Controller) (cpuLayout, error) {
+	l := cpuLayout{
+		topo:     cli.CpuTopology(),
+		policy:   cli.Placement,
+		reserved: cli.ReservedCpus(),
+		batch:    cli.BatchCpus(),
+	}
+	l.lendable = l.reserved[1:]
+	if l.policy.AvoidMemcachedSiblings {
+		l.batch = l.topo.WithoutSiblingsOf(l.batch, l.reserved)
+		l.lendable = l.topo.WithoutSiblingsOf(l.lendable, l.reserved[:1])
+	}
+	if len(l.batch)+len(l.lendable) == 0 {
+		return l, errors.New("no cpus left for jobs by the placement policy")
+	}
+	return l, nil
+}
+
+// The core that memcached always runs on.
+func (l cpuLayout) memcachedCore() int {
+	return l.reserved[0]
+}
+
+// The reserved cpus that jobs may use while memcached runs on one core.
+func (l cpuLayout) shared() controller.CpuList {
+	return l.lendable
+}
+
+// The cpus among the given ones that a job may run on: batch-only jobs stay off the
+// shared cpus, unless there are no batch cpus at all.
+func (l cpuLayout) usable(job *controller.JobInfo, cpus controller.CpuList) controller.CpuList {
+	if job.BatchOnly && len(l.batch) > 0 {
+		return withoutCpus(cpus, l.shared())
+	}
+	return cpus
+}
+
+// Cpus that jobs may run on, the batch cpus first because jobs there are less likely
+// to be paused.
+func (l cpuLayout) jobCpus() controller.CpuList {
+	cpus := make(controller.CpuList, 0, len(l.batch)+len(l.shared()))
+	for i := len(l.batch) - 1; i >= 0; i-- {
+		cpus = append(cpus, l.batch[i])
+	}
+	for i := len(l.shared()) - 1; i >= 0; i-- {
+		cpus = append(cpus, l.shared()[i])
+	}
+	return cpus
+}
+
+// All cpus that jobs may run on, in increasing order.
+func (l cpuLayout) allJobCpus() controller.CpuList {
+	cpus := l.jobCpus()
+	sort.Ints(cpus)
+	return cpus
+}
+
+// Cpus that jobs may run on and that nothing runs on, in order of preference.
+func (l cpuLayout) freeCpus(alloc *CpuAllocator) controller.CpuList {
+	return alloc.Free(l.jobCpus())
+}
+
+// Whether there are shared cpus and nothing runs on them.
+func (l cpuLayout) sharedFree(alloc *CpuAllocator) bool {
+	return len(l.shared()) > 0 && len(alloc.Free(l.shared())) == len(l.shared())
+}
+
+// Choose n of the free cpus for a job, in their order of preference. With SameNode, the
+// cpus must come from a single node, unless no node has n cpus for jobs at all.
+func (l cpuLayout) pick(free controller.CpuList, n int) (controller.CpuList, bool) {
+	if n > len(free) {
+		return nil, false
+	}
+	if !l.policy.SameNode || n > l.nodeCapacity() {
+		return free[:n], true
+	}
+	for _, group := range l.topo.ByNode(free) {
+		if len(group) >= n {
+			return group[:n], true
+		}
+	}
+	return nil, false
+}
+
+// Choose as many of the free cpus as the policy allows for a single job: with SameNode,
+// those of the node with the most free cpus.
+func (l cpuLayout) pickAll(free controller.CpuList) controller.CpuList {
+	if !l.policy.SameNode {
+		return free
+	}
+	var largest controller.CpuList
+	for _, group := range l.topo.ByNode(free) {
+		if len(group) > len(largest) {
+			largest = group
+		}
+	}
+	return largest
+}
+
+// Restrict cpus to the node of a job's current cpus if the policy keeps jobs within one node
+// and that node has any of them.
+func (l cpuLayout) sameNodeAs(cpus, current controller.CpuList) controller.CpuList {
+	if !l.policy.SameNode || len(current) == 0 {
+		return cpus
+	}
+	node := l.topo.Node(current[0])
+	var rest controller.CpuList
+	for _, core := range cpus {
+		if l.topo.Node(core) == node {
+			rest = append(rest, core)
+		}
+	}
+	if len(rest) == 0 {
+		return cpus
+	}
+	return rest
+}
+
+// Whether a job on current may extend to any of cpus under the policy.
+func (l cpuLayout) canExtend(current, cpus controller.CpuList) bool {
+	if !l.policy.SameNode || len(current) == 0 {
+		return true
+	}
+	node := l.topo.Node(current[0])
+	for _, core := range cpus {
+		if l.topo.Node(core) == node {
+			return true
+		}
+	}
+	return false
+}
+
+// The largest number of cpus for jobs within one node.
+func (l cpuLayout) nodeCapacity() int {
+	capacity := 0
+	for _, group := range l.topo.ByNode(l.jobCpus()) {
+		if len(group) > capacity {
+			capacity = len(group)
+		}
+	}
+	return capacity
+}
+
+// The cpus without the removed ones, keeping their order.
+func withoutCpus(cpus, removed controller.CpuList) controller.CpuList {
+	skip := make(map[int]bool, len(removed))
+	for _, core := range removed {
+		skip[core] = true
+	}
+	rest := make(controller.CpuList, 0, len(cpus))
+	for _, core := range cpus {
+		if !skip[core] {
+			rest = append(rest, core)
+		}
+	}
+	return rest
+}
@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+
+	"ethz.ch/ccsched/controller"
+)
+
+// depGraph tracks the dependencies between jobs. A job becomes ready once every job it
+// depends on has exited successfully, and is skipped if one of them fails or is skipped.
+type depGraph struct {
+	deps       map[string][]string // Jobs that each job depends on.
+	dependents map[string][]string // Jobs that depend on each job.
+	succeeded  map[string]bool
+	skipped    map[string]bool
+}
+
+func newDepGraph(jobs []controller.JobInfo) (*depGraph, error) {
+	if err := controller.CheckDependencies(jobs); err != nil {
+		return nil, err
+	}
+	g := &depGraph{
+		deps:       make(map[string][]string),
+		dependents: make(map[string][]string),
+		succeeded:  make(map[string]bool),
+		skipped:    make(map[string]bool),
+	}
+	for _, job := range jobs {
+		g.deps[job.Name] = job.Dependencies
+		for _, dep := range job.Dependencies {
+			g.dependents[dep] = append(g.dependents[dep], job.Name)
+		}
+	}
+	return g, nil
+}
+
+// Whether all the jobs a job depends on have exited successfully.
+func (g *depGraph) ready(id string) bool {
+	for _, dep := range g.deps[id] {
+		if !g.succeeded[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// Record that a job has exited, and return the jobs that can no longer run because of it.
+func (g *depGraph) exited(id string, exitCode int) (skipped []string) {
+	if exitCode == 0 {
+		g.succeeded[id] = true
+		return nil
+	}
+	var skip func(id string)
+	skip = func(id string) {
+		for _, dependent := range g.dependents[id] {
+			if !g.skipped[dependent] {
+				g.skipped[dependent] = true
+				skipped = append(skipped, dependent)
+				skip(dependent)
+			}
+		}
+	}
+	skip(id)
+	return skipped
+}
+
+// Record that a job will not run because a job it depends on has failed.
+func recordSkipped(ctx context.Context, cli *controller.Controller, id, failed string) {
+	log.Printf("Skipping job %v, job %v failed", id, failed)
+	cli.RecordEvent(controller.WithReason(ctx, "dependency failed"),
+		controller.Event{Type: controller.EventJobSkipped, Job: id})
+}
+
+// Exit code of a job that has exited, -1 if the runtime cannot tell.
+func exitCodeOf(ctx context.Context, cli *controller.Controller, id string) int {
+	status, err := cli.JobStatus(ctx, id)
+	if err != nil {
+		log.Printf("Error getting the exit code of job %v: %v", id, err)
+		return -1
+	}
+	return status.ExitCode
+}
@@ -0,0 +1,36 @@
+package scheduler
+
+import (
+	"sort"
+
+	"ethz.ch/ccsched/controller"
+)
+
+// Index a copy of the jobs by name.
+func newJobMap(jobs []controller.JobInfo) map[string]*controller.JobInfo {
+	jobMap := make(map[string]*controller.JobInfo, len(jobs))
+	for i := range jobs {
+		job := jobs[i]
+		jobMap[job.Name] = &job
+	}
+	return jobMap
+}
+
+// Sort jobs by decreasing priority, favoring the ones expected to finish earlier.
+func sortJobs(jobs []*controller.JobInfo) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Priority != jobs[j].Priority {
+			return jobs[i].Priority > jobs[j].Priority
+		}
+		return jobs[i].Eta < jobs[j].Eta
+	})
+}
+
+// Names of the jobs in a set, in no particular order.
+func jobNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for id := range set {
+		names = append(names, id)
+	}
+	return names
+}
@@ -0,0 +1,166 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"ethz.ch/ccsched/controller"
+)
+
+// The jobs of a dynamic scheduler by state, and the cpus they hold. It drives the jobs
+// through the controller, so that the schedulers handle errors, ETAs, cpus and
+// dependencies alike.
+type jobSet struct {
+	jobs          map[string]*controller.JobInfo
+	createdJobs   map[string]bool
+	runningJobs   map[string]bool
+	pausedJobs    map[string]bool
+	completedJobs int // Jobs that have exited, or have been skipped.
+	deps          *depGraph
+	alloc         *CpuAllocator
+}
+
+// Create the jobs, none of which holds cpus yet.
+func (s *jobSet) init(ctx context.Context, cli *controller.Controller, jobs []controller.JobInfo) error {
+	deps, err := newDepGraph(jobs)
+	if err != nil {
+		return err
+	}
+	s.jobs = newJobMap(jobs)
+	s.deps = deps
+
+	s.createdJobs = make(map[string]bool)
+	s.runningJobs = make(map[string]bool)
+	s.pausedJobs = make(map[string]bool)
+	s.completedJobs = 0
+	for id, job := range s.jobs {
+		if err := cli.CreateJob(ctx, job); err != nil {
+			return err
+		}
+		s.createdJobs[id] = true
+	}
+	s.alloc = NewCpuAllocator(cli.CpuTopology().Online())
+	return nil
+}
+
+func (s *jobSet) done() bool {
+	return s.completedJobs == len(s.jobs)
+}
+
+func (s *jobSet) running() []string {
+	return jobNames(s.runningJobs)
+}
+
+// The jobs that may run: those paused, and those created whose dependencies have completed.
+func (s *jobSet) availableJobs() []*controller.JobInfo {
+	jobs := make([]*controller.JobInfo, 0, len(s.createdJobs)+len(s.pausedJobs))
+	for id := range s.createdJobs {
+		if s.deps.ready(id) {
+			jobs = append(jobs, s.jobs[id])
+		}
+	}
+	for id := range s.pausedJobs {
+		jobs = append(jobs, s.jobs[id])
+	}
+	return jobs
+}
+
+func (s *jobSet) startJob(ctx context.Context, cli *controller.Controller, job *controller.JobInfo) error {
+	id := job.Name
+	if err := cli.StartJob(ctx, id); err != nil {
+		return err
+	}
+	s.runningJobs[id] = true
+	delete(s.createdJobs, id)
+	return nil
+}
+
+func (s *jobSet) pauseJob(ctx context.Context, cli *controller.Controller, job *controller.JobInfo) {
+	id := job.Name
+	if err := cli.PauseJob(ctx, id); errors.Is(err, controller.ErrAlreadyExited) {
+		s.completeJob(ctx, cli, id, exitCodeOf(ctx, cli, id))
+	} else if err != nil {
+		log.Printf("Error pausing job %v: %v", id, err)
+	} else {
+		cli.UpdateEta(job)
+		delete(s.runningJobs, id)
+		s.pausedJobs[id] = true
+		s.alloc.Release(id)
+	}
+}
+
+// Pause a job to hand its cpus to memcached. A job that cannot be paused gives them up
+// all the same, so that memcached is never kept from growing: it runs on next to
+// memcached, without cpus of its own, until it exits.
+func (s *jobSet) evictJob(ctx context.Context, cli *controller.Controller, job *controller.JobInfo) {
+	s.pauseJob(ctx, cli, job)
+	if s.runningJobs[job.Name] {
+		log.Printf("Job %v keeps running next to memcached", job.Name)
+		s.alloc.Release(job.Name)
+	}
+}
+
+func (s *jobSet) unpauseJob(ctx context.Context, cli *controller.Controller, job *controller.JobInfo) error {
+	id := job.Name
+	if err := cli.UnpauseJob(ctx, id); errors.Is(err, controller.ErrAlreadyExited) {
+		s.completeJob(ctx, cli, id, exitCodeOf(ctx, cli, id))
+		return nil
+	} else if err != nil {
+		return err
+	}
+	delete(s.pausedJobs, id)
+	s.runningJobs[id] = true
+	return nil
+}
+
+func (s *jobSet) startOrUnpauseJob(ctx context.Context, cli *controller.Controller, job *controller.JobInfo) error {
+	if _, isCreated := s.createdJobs[job.Name]; isCreated {
+		return s.startJob(ctx, cli, job)
+	}
+	if _, isPaused := s.pausedJobs[job.Name]; isPaused {
+		return s.unpauseJob(ctx, cli, job)
+	}
+	return nil
+}
+
+// Pin a job to the given cpus, noticing if it has exited in the meantime.
+func (s *jobSet) setJobCpus(ctx context.Context, cli *controller.Controller, job *controller.JobInfo, cpuList controller.CpuList) error {
+	if err := s.alloc.Resize(job.Name, cpuList); err != nil {
+		return err
+	}
+	err := cli.SetJobCpuAffinity(ctx, job, cpuList)
+	if errors.Is(err, controller.ErrAlreadyExited) {
+		s.completeJob(ctx, cli, job.Name, exitCodeOf(ctx, cli, job.Name))
+		return nil
+	}
+	return err
+}
+
+// Pin a job to the given cpus and let it run.
+func (s *jobSet) placeJob(ctx context.Context, cli *controller.Controller, job *controller.JobInfo, cpuList controller.CpuList) error {
+	if err := s.setJobCpus(ctx, cli, job, cpuList); err != nil {
+		return err
+	}
+	return s.startOrUnpauseJob(ctx, cli, job)
+}
+
+// Record that a job has exited, whatever state the scheduler believed it was in.
+// If it failed, the jobs that depend on it are skipped.
+func (s *jobSet) completeJob(ctx context.Context, cli *controller.Controller, id string, exitCode int) {
+	if !s.createdJobs[id] && !s.runningJobs[id] && !s.pausedJobs[id] {
+		return
+	}
+	delete(s.createdJobs, id)
+	delete(s.runningJobs, id)
+	delete(s.pausedJobs, id)
+	s.alloc.Release(id)
+	s.completedJobs++
+	log.Println("Completed job", id)
+	cli.RecordEvent(ctx, controller.Event{Type: controller.EventJobCompleted, Job: id, ExitCode: exitCode})
+	for _, skipped := range s.deps.exited(id, exitCode) {
+		delete(s.createdJobs, skipped)
+		s.completedJobs++
+		recordSkipped(ctx, cli, skipped, id)
+	}
+}
@@ -0,0 +1,152 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"ethz.ch/ccsched/controller"
+)
+
+// The reactions of a scheduler to the events of its run loop.
+type loopHandler interface {
+	// Whether all jobs have completed.
+	done() bool
+
+	// Jobs that the scheduler believes are running.
+	running() []string
+
+	// A job has exited, successfully if exitCode is 0.
+	jobExited(ctx context.Context, cli *controller.Controller, id string, exitCode int) error
+
+	// A new cpu usage sample is available.
+	tick(ctx context.Context, cli *controller.Controller, sample controller.CpuSample) error
+}
+
+// Drive a scheduler until all of its jobs have completed. Job exits are handled as soon
+// as the runtime reports them, cpu samples are taken every interval. If the event stream
+// is lost, the running jobs are polled at every sample instead.
+func runEventLoop(ctx context.Context, cli *controller.Controller, interval time.Duration, h loopHandler) error {
+	events := cli.JobEvents(ctx)
+	// Jobs started before the subscription may have exited unnoticed.
+	if err := pollExited(ctx, cli, h); err != nil {
+		return err
+	}
+	ticker := cli.NewCpuTicker(ctx, interval)
+
+	handleEvent := func(ev controller.JobEvent) error {
+		switch ev.Type {
+		case controller.JobExited:
+			if ev.ExitCode != 0 {
+				log.Printf("Job %v exited with code %v", ev.Job, ev.ExitCode)
+			}
+			return h.jobExited(ctx, cli, ev.Job, ev.ExitCode)
+		case controller.JobOOM:
+			log.Printf("Job %v ran out of memory", ev.Job)
+		}
+		return nil
+	}
+
+	for !h.done() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case ev, ok := <-events:
+			if !ok {
+				log.Println("Lost job events, polling job states instead")
+				events = nil
+				continue
+			}
+			if err := handleEvent(ev); err != nil {
+				return err
+			}
+
+		case sample := <-ticker.C:
+			// Catch up with the events that happened while sampling.
+			for pending := events != nil; pending; {
+				select {
+				case ev, ok := <-events:
+					if !ok {
+						log.Println("Lost job events, polling job states instead")
+						events = nil
+						pending = false
+					} else if err := handleEvent(ev); err != nil {
+						return err
+					}
+				default:
+					pending = false
+				}
+			}
+			if sample.Err != nil {
+				return fmt.Errorf("get cpu usage: %w", sample.Err)
+			}
+			cli.RecordEvent(ctx, controller.Event{
+				Type:       controller.EventCpuSample,
+				CpuUsage:   sample.Usage,
+				JobCpu:     sample.Jobs,
+				ServiceCpu: sample.Services,
+				Pressure:   sample.Pressure,
+			})
+
+			if events == nil {
+				if err := pollExited(ctx, cli, h); err != nil {
+					return err
+				}
+			}
+			if h.done() {
+				return nil
+			}
+
+			if err := h.tick(ctx, cli, sample); err != nil {
+				return err
+			}
+			ticker.Next()
+		}
+	}
+	return nil
+}
+
+// Look up the state of the running jobs, for the exits that no event reported.
+func pollExited(ctx context.Context, cli *controller.Controller, h loopHandler) error {
+	for _, id := range h.running() {
+		status, err := cli.JobStatus(ctx, id)
+		if err != nil {
+			return err
+		}
+		if status.State == controller.StateExited {
+			if err := h.jobExited(ctx, cli, id, status.ExitCode); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Log the usage of every cpu and, if known, what it is used by and how long tasks waited.
+func logCpuSample(sample controller.CpuSample) {
+	log.Println("cpu usage: ", sample.Usage)
+	if len(sample.Jobs)+len(sample.Services) > 0 {
+		log.Printf("cpu usage by job: %v, by service: %v", formatUsage(sample.Jobs), formatUsage(sample.Services))
+	}
+	if p := sample.Pressure; p != nil {
+		log.Printf("cpu stalls: host %.1f%%, memcached %.1f%%", p.Cpu.Some, p.Memcached.Some)
+	}
+}
+
+// Utilizations by name, sorted by name, e.g. "ferret=199.5 fft=0.0".
+func formatUsage(usage map[string]float64) string {
+	names := make([]string, 0, len(usage))
+	for name := range usage {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%v=%.1f", name, usage[name])
+	}
+	return strings.Join(parts, " ")
+}
@@ -2,240 +2,206 @@ package scheduler
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"sort"
 	"time"
 
 	"ethz.ch/ccsched/controller"
-	"github.com/shirou/gopsutil/v3/cpu"
+	"ethz.ch/ccsched/cpustat"
 )
 
 // A dyncamic scheduler that keeps memcached running on one dedicated core.
 // Only 1 PARSEC job is running at a time.
 
+func init() {
+	Register("mc1large", "Dynamic scheduler that runs one multi-threaded job at a time next to memcached",
+		func() Scheduler { return &MC1LargeScheduler{} })
+}
+
 type MC1LargeScheduler struct {
-	jobs          map[string]*controller.JobInfo
-	createdJobs   map[string]bool
-	runningJobs   map[string]bool
-	pausedJobs    map[string]bool
-	completedJobs int
-	mc1core       bool // whether memcached is running only on one core.
-	cpuStat       [ncpu][cpuWnd]float64
+	jobSet
+	mc1core   bool // whether memcached is running only on one core.
+	cpus      cpuLayout
+	cpuStat   *cpustat.Window
+	memcached memcachedMonitor
 }
 
-func (s *MC1LargeScheduler) Init(ctx context.Context, cli *controller.Controller) {
-	s.jobs = map[string]*controller.JobInfo{
-		"ferret":       {Name: "ferret", Threads: 3, Eta: 320 * time.Second},
-		"freqmine":     {Name: "freqmine", Threads: 3, Eta: 200 * time.Second},
-		"blackscholes": {Name: "blackscholes", Threads: 3, Eta: 90 * time.Second},
-		"dedup":        {Name: "dedup", Threads: 3, Eta: 35 * time.Second},
-		"canneal":      {Name: "canneal", Threads: 3, Eta: 240 * time.Second},
-		"splash2x-fft": {Name: "splash2x-fft", Threads: 2, Eta: 110 * time.Second},
+func (s *MC1LargeScheduler) Init(ctx context.Context, cli *controller.Controller, jobs []controller.JobInfo) error {
+	if err := s.init(ctx, cli, jobs); err != nil {
+		return err
 	}
 
-	s.createdJobs = make(map[string]bool)
-	s.runningJobs = make(map[string]bool)
-	s.pausedJobs = make(map[string]bool)
-	for id, job := range s.jobs {
-		cli.CreateJob(ctx, job)
-		s.createdJobs[id] = true
+	var err error
+	if s.cpus, err = newCpuLayout(cli); err != nil {
+		return err
 	}
+	s.cpuStat = cpustat.NewWindow(cli.CpuTopology().Size(), cpuWnd)
+	s.cpuStat.Fill(0)
 
-	// Assume memcached run on 2 cores at the start.
+	// Assume memcached run on all reserved cores at the start.
 	s.mc1core = false
+	return s.alloc.Allocate(memcachedOwner, s.cpus.reserved)
+}
 
+func (s *MC1LargeScheduler) Run(ctx context.Context, cli *controller.Controller) error {
+	return runEventLoop(ctx, cli, cpuStatInterval*time.Millisecond, s)
 }
 
-func (s *MC1LargeScheduler) Run(ctx context.Context, cli *controller.Controller) {
-	numJobs := len(s.jobs)
-	for s.completedJobs != numJobs {
-		s.updateCpuStat()
+// Hand the cores of a completed job to the next ones right away.
+func (s *MC1LargeScheduler) jobExited(ctx context.Context, cli *controller.Controller, id string, exitCode int) error {
+	s.completeJob(ctx, cli, id, exitCode)
+	return s.schedule(controller.WithReason(ctx, "job completed"), cli)
+}
 
-		cpu0HighUsage := true
-		cpu0LowUsage := true
-		for _, perc := range s.cpuStat[0] {
-			if perc < highUsageThresh {
-				cpu0HighUsage = false
+func (s *MC1LargeScheduler) tick(ctx context.Context, cli *controller.Controller, sample controller.CpuSample) error {
+	s.cpuStat.Add(sample.Usage)
+	logCpuSample(sample)
+
+	core := s.cpus.memcachedCore()
+	grow, shrink, reason := s.memcached.check(ctx, cli, core, s.cpuStat.Core(core), sample.Pressure)
+
+	if grow && s.mc1core {
+		// memcached run on 2 cores to avoid SLO violation.
+		ctx := controller.WithReason(ctx, reason)
+		// Move the jobs off the shared cpus to what is left of the batch ones.
+		for _, id := range s.alloc.Owners(s.cpus.shared()) {
+			job := s.jobs[id]
+			cpus := withoutCpus(s.alloc.Cpus(id), s.cpus.shared())
+			cpus = append(cpus, s.alloc.Free(s.cpus.sameNodeAs(s.cpus.batch, job.CpuList))...)
+			if len(cpus) == 0 {
+				s.evictJob(ctx, cli, job)
+				continue
 			}
-			if perc > lowUsageThresh {
-				cpu0LowUsage = false
+			sort.Ints(cpus)
+			if err := s.setJobCpus(ctx, cli, job, cpus); err != nil {
+				log.Printf("Error moving job %v off cpus %v: %v", id, s.cpus.shared(), err)
+				s.evictJob(ctx, cli, job)
 			}
 		}
-
-		if cpu0HighUsage && s.mc1core {
-			// memcached run on 2 cores to avoid SLO violation.
-			cli.SetMemcachedCpuAffinity(controller.CpuList{0, 1})
-			cpuJobs := s.getCpuJobs() // will not contain memcached for cpu1.
-			for _, id := range cpuJobs[1] {
-				cli.SetJobCpuAffinity(ctx, s.jobs[id], controller.CpuList{2, 3})
-			}
+		if err := s.alloc.Resize(memcachedOwner, s.cpus.reserved); err != nil {
+			log.Println(err)
+		} else if err := cli.SetMemcachedCpuAffinity(ctx, s.cpus.reserved); err != nil {
+			log.Println(err)
+			s.alloc.Resize(memcachedOwner, s.cpus.reserved[:1])
+		} else {
 			s.mc1core = false
 		}
+	}
 
-		if cpu0LowUsage && !s.mc1core {
-			// memcached run on 1 core to spare resources for PARSEC.
-			cli.SetMemcachedCpuAffinity(controller.CpuList{0})
+	if shrink && !s.mc1core {
+		// memcached run on 1 core to spare resources for PARSEC.
+		ctx := controller.WithReason(ctx, reason)
+		if err := cli.SetMemcachedCpuAffinity(ctx, s.cpus.reserved[:1]); err != nil {
+			log.Println(err)
+		} else {
+			if err := s.alloc.Resize(memcachedOwner, s.cpus.reserved[:1]); err != nil {
+				log.Println(err)
+			}
 			s.mc1core = true
 		}
+	}
 
-		cpuJobs := s.getCpuJobs()
-		if len(cpuJobs[1]) == 0 {
-			// Make use of the extra core.
-			for id := range s.runningJobs {
-				if id != "splash2x-fft" {
-					cli.SetJobCpuAffinity(ctx, s.jobs[id], controller.CpuList{1, 2, 3})
-				}
-			}
-		}
+	return s.schedule(controller.WithReason(ctx, "cpus available"), cli)
+}
 
-		// Handle fft jobs separately.
-		fftJob := s.jobs["splash2x-fft"]
-		cpuJobs = s.getCpuJobs()
-		availCpus := make([]int, 0, ncpu)
-		for core := ncpu - 1; core >= 1; core-- {
-			if len(cpuJobs[core]) == 0 {
-				availCpus = append(availCpus, core)
+func (s *MC1LargeScheduler) schedule(ctx context.Context, cli *controller.Controller) error {
+	if s.cpus.sharedFree(s.alloc) {
+		// Make use of the extra core.
+		ctx := controller.WithReason(ctx, fmt.Sprintf("cpu%v free", s.cpus.shared()))
+		running := jobNames(s.runningJobs)
+		sort.Strings(running)
+		for _, id := range running {
+			job := s.jobs[id]
+			if job.BatchOnly {
+				continue
 			}
-		}
-		_, fftRunning := s.runningJobs["splash2x-fft"]
-		availJobs := s.populateAvailableJobs()
-		if hasJob(availJobs, "splash2x-fft") {
-			if (!s.mc1core && len(availCpus) == 2) ||
-				(len(availJobs) == 1 && len(availCpus) >= 2) {
-				cli.SetJobCpuAffinity(ctx, fftJob, availCpus)
-				s.startOrUnpauseJob(ctx, cli, fftJob)
+			free := s.alloc.Free(s.cpus.sameNodeAs(s.cpus.allJobCpus(), job.CpuList))
+			if len(free) == 0 {
+				continue // No free cpu on the node of the job.
+			}
+			cpus := append(append(controller.CpuList(nil), s.alloc.Cpus(id)...), free...)
+			sort.Ints(cpus)
+			if err := s.setJobCpus(ctx, cli, job, cpus); err != nil {
+				return err
 			}
 		}
-		if fftRunning && len(cpuJobs[1]) == 0 && len(availJobs) > 0 {
-			// Pause fft if other jobs can make use of the extra cpu.
-			s.pauseJob(ctx, cli, fftJob)
-		}
+	}
 
-		// Schedule jobs sequentially, favoring ones that are expected to finish earlier.
-		cpuJobs = s.getCpuJobs()
-		availCpus = make([]int, 0, ncpu)
-		availJobs = s.populateAvailableJobs()
-		for core := ncpu - 1; core >= 1; core-- {
-			if len(cpuJobs[core]) == 0 {
-				availCpus = append(availCpus, core)
-			}
+	// Handle batch-only jobs separately: they run while memcached needs all of its cpus,
+	// or when nothing else is left.
+	batchOnlyRunning := s.runningBatchOnlyJobs()
+	availJobs := s.populateAvailableJobs()
+	for _, job := range availJobs {
+		if !job.BatchOnly {
+			continue
 		}
-		if len(availCpus) >= 2 && len(availJobs) > 0 {
-			job := availJobs[0]
-			cli.SetJobCpuAffinity(ctx, job, availCpus)
-			s.startOrUnpauseJob(ctx, cli, job)
+		availCpus := s.cpus.usable(job, s.cpus.freeCpus(s.alloc))
+		if len(availCpus) == 0 {
+			continue // Never start a job without cpus.
 		}
-
-		// Check for completed jobs.
-		for id := range s.runningJobs {
-			res, err := cli.ContainerInspect(ctx, id)
-			if err != nil {
-				log.Fatal(err)
-			}
-			if res.State.Status == "exited" {
-				// Job has completed.
-				s.completedJobs++
-				log.Println("Completed job", id)
-				delete(s.runningJobs, id)
+		if (!s.mc1core && len(availCpus) == len(s.cpus.batch)) ||
+			(!hasOtherJobs(availJobs) && len(availCpus) >= s.minCpus()) {
+			if err := s.placeJob(ctx, cli, job, s.cpus.pickAll(availCpus)); err != nil {
+				return err
 			}
 		}
-
-	}
-}
-
-// Find all available jobs and categorize them into single or multi-threaded jobs sorted by ETA.
-func (s *MC1LargeScheduler) populateAvailableJobs() (availJobs []*controller.JobInfo) {
-	availJobs = make([]*controller.JobInfo, 0, len(s.jobs))
-	for id := range s.createdJobs {
-		job := s.jobs[id]
-		availJobs = append(availJobs, job)
-	}
-	for id := range s.pausedJobs {
-		job := s.jobs[id]
-		availJobs = append(availJobs, job)
 	}
-
-	sort.Slice(availJobs, func(i, j int) bool {
-		return availJobs[i].Eta < availJobs[j].Eta
-	})
-	return
-}
-
-func (s *MC1LargeScheduler) startJob(ctx context.Context, cli *controller.Controller, job *controller.JobInfo) {
-	id := job.Name
-	cli.StartJob(ctx, id)
-	job.LastUnpaused = time.Now()
-	s.runningJobs[id] = true
-	delete(s.createdJobs, id)
-}
-
-func (s *MC1LargeScheduler) pauseJob(ctx context.Context, cli *controller.Controller, job *controller.JobInfo) {
-	id := job.Name
-	if err := cli.PauseJob(ctx, id); err != nil {
-		log.Printf("Error pausing job %v: %v", id, err)
-	} else {
-		elapsedTime := time.Now().Sub(job.LastUnpaused)
-		if elapsedTime > job.Eta {
-			log.Println("ETA underestimated for job", job.Name)
-			job.Eta = 15
-		} else {
-			job.Eta -= elapsedTime
+	for _, job := range batchOnlyRunning {
+		if s.cpus.sharedFree(s.alloc) && s.cpus.canExtend(job.CpuList, s.cpus.shared()) && hasOtherJobs(availJobs) {
+			// Pause the job if other jobs can make use of the extra cpu.
+			ctx := controller.WithReason(ctx, fmt.Sprintf("cpu%v free for other jobs", s.cpus.shared()))
+			s.pauseJob(ctx, cli, job)
 		}
-		delete(s.runningJobs, id)
-		s.pausedJobs[id] = true
 	}
-}
 
-func (s *MC1LargeScheduler) unpauseJob(ctx context.Context, cli *controller.Controller, job *controller.JobInfo) {
-	id := job.Name
-	cli.UnpauseJob(ctx, id)
-	job.LastUnpaused = time.Now()
-	delete(s.pausedJobs, id)
-	s.runningJobs[id] = true
-}
-
-func (s *MC1LargeScheduler) startOrUnpauseJob(ctx context.Context, cli *controller.Controller, job *controller.JobInfo) {
-	if _, isCreated := s.createdJobs[job.Name]; isCreated {
-		s.startJob(ctx, cli, job)
-	}
-	if _, isPaused := s.pausedJobs[job.Name]; isPaused {
-		s.unpauseJob(ctx, cli, job)
+	// Schedule the other jobs sequentially, favoring ones that are expected to finish earlier.
+	for _, job := range s.populateAvailableJobs() {
+		if job.BatchOnly {
+			continue
+		}
+		if availCpus := s.cpus.freeCpus(s.alloc); len(availCpus) >= s.minCpus() {
+			if err := s.placeJob(ctx, cli, job, s.cpus.pickAll(availCpus)); err != nil {
+				return err
+			}
+		}
+		break
 	}
+	return nil
 }
 
-// Maintain a window of cpu percentage usage per core.
-func (s *MC1LargeScheduler) updateCpuStat() {
-	cpuUsage, err := cpu.Percent(cpuStatInterval*time.Millisecond, true)
-	if err != nil {
-		log.Fatal("Error geting cpu usage:", err)
-	}
-	for c := 0; c < ncpu; c++ {
-		for i := cpuWnd - 1; i >= 1; i-- {
-			s.cpuStat[c][i] = s.cpuStat[c][i-1]
+// The running jobs that only run on the batch cpus, sorted by name.
+func (s *MC1LargeScheduler) runningBatchOnlyJobs() (jobs []*controller.JobInfo) {
+	running := jobNames(s.runningJobs)
+	sort.Strings(running)
+	for _, id := range running {
+		if job := s.jobs[id]; job.BatchOnly {
+			jobs = append(jobs, job)
 		}
-		s.cpuStat[c][0] = cpuUsage[c]
 	}
+	return
+}
 
-	log.Println("cpu usage: ", cpuUsage)
+// Find all available jobs, those paused or whose dependencies have completed, sorted by ETA.
+func (s *MC1LargeScheduler) populateAvailableJobs() []*controller.JobInfo {
+	availJobs := s.availableJobs()
+	sortJobs(availJobs)
+	return availJobs
 }
 
-// Get running jobs on all cpus.
-func (s *MC1LargeScheduler) getCpuJobs() (cpuJobs [ncpu][]string) {
-	cpuJobs[0] = append(cpuJobs[0], "memcached")
-	if !s.mc1core {
-		cpuJobs[1] = append(cpuJobs[1], "memcached")
+// Cpus needed to start a job: two, unless there are fewer batch cpus, as the reserved ones
+// may never be lent if memcached stays busy.
+func (s *MC1LargeScheduler) minCpus() int {
+	if len(s.cpus.batch) < 2 {
+		return 1
 	}
-	for id := range s.runningJobs {
-		for _, core := range s.jobs[id].CpuList {
-			cpuJobs[core] = append(cpuJobs[core], id)
-		}
-	}
-	return
+	return 2
 }
 
-func hasJob(s []*controller.JobInfo, e string) bool {
-	for _, a := range s {
-		if a.Name == e {
+// Whether some of the jobs may also run on the cpus lent by memcached.
+func hasOtherJobs(jobs []*controller.JobInfo) bool {
+	for _, job := range jobs {
+		if !job.BatchOnly {
 			return true
 		}
 	}
@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"ethz.ch/ccsched/controller"
+	"ethz.ch/ccsched/cpustat"
+)
+
+// Thresholds on the p95 latency of memcached, as fractions of its SLO.
+const (
+	highLatencyFrac = 0.8 // Less headroom than this calls for a second core.
+	lowLatencyFrac  = 0.5 // More headroom than this over the whole window lets memcached go down to one core.
+)
+
+// Thresholds on the percent of time memcached waits for a cpu, from its cpu pressure.
+const (
+	highStallThresh = 10 // Stalls above this over the whole window call for a second core.
+	lowStallThresh  = 2  // Stalls below this over the whole window let memcached go down to one core.
+)
+
+// Decides whether memcached needs a second core or can do with one. The p95 latency is
+// used when the controller measures it, the usage of cpu0 otherwise. The cpu stalls of
+// memcached are used instead of the usage, or alongside it, when the controller measures them.
+type memcachedMonitor struct {
+	latency *cpustat.Ring // p95 latencies in ns, created on the first one.
+	stall   *cpustat.Ring // Percent of time memcached waited for a cpu, created on the first sample.
+}
+
+// Check the latest measurements. usage is the window of usage samples of the core that
+// memcached always runs on, pressure the latest stalls if measured.
+func (m *memcachedMonitor) check(ctx context.Context, cli *controller.Controller, core int, usage *cpustat.Ring, pressure *controller.PressureSample) (grow, shrink bool, reason string) {
+	if cli.Latency != nil {
+		stats, err := cli.MemcachedLatency(ctx)
+		if err == nil {
+			return m.checkLatency(stats.P95, cli.LatencySLO())
+		}
+		if !errors.Is(err, controller.ErrNoLatency) {
+			log.Println("Error measuring memcached latency, falling back to cpu usage:", err)
+		}
+	}
+
+	if pressure != nil {
+		if m.stall == nil {
+			m.stall = cpustat.NewRing(cpuWnd)
+		}
+		m.stall.Add(pressure.Memcached.Some)
+	}
+	if cli.Pressure == nil {
+		return checkUsage(core, usage)
+	}
+	if cli.PressureOnly {
+		return m.checkStall()
+	}
+
+	// Either signal calls for a second core, but both must allow going down to one.
+	usageGrow, usageShrink, usageReason := checkUsage(core, usage)
+	stallGrow, stallShrink, stallReason := m.checkStall()
+	switch {
+	case usageGrow:
+		return true, false, usageReason
+	case stallGrow:
+		return true, false, stallReason
+	case usageShrink && stallShrink:
+		return false, true, usageReason + " and " + stallReason
+	}
+	return false, false, ""
+}
+
+// Only act on usage that stayed beyond a threshold for the whole window.
+func checkUsage(core int, usage *cpustat.Ring) (grow, shrink bool, reason string) {
+	grow = usage.Estimate(cpustat.Min) >= highUsageThresh
+	shrink = usage.Estimate(cpustat.Max) <= lowUsageThresh
+	if grow {
+		reason = fmt.Sprintf("cpu%v usage above high threshold", core)
+	} else if shrink {
+		reason = fmt.Sprintf("cpu%v usage below low threshold", core)
+	}
+	return
+}
+
+// Only act on stalls that stayed beyond a threshold for the whole window.
+func (m *memcachedMonitor) checkStall() (grow, shrink bool, reason string) {
+	if m.stall == nil || !m.stall.Full() {
+		return false, false, ""
+	}
+	if m.stall.Estimate(cpustat.Min) >= highStallThresh {
+		return true, false, "memcached cpu stalls above high threshold"
+	}
+	if m.stall.Estimate(cpustat.Max) <= lowStallThresh {
+		return false, true, "memcached cpu stalls below low threshold"
+	}
+	return false, false, ""
+}
+
+// Grow as soon as the latency gets close to the SLO, but only shrink once it has been
+// far from it for the whole window.
+func (m *memcachedMonitor) checkLatency(p95, slo time.Duration) (grow, shrink bool, reason string) {
+	if m.latency == nil {
+		m.latency = cpustat.NewRing(cpuWnd)
+	}
+	m.latency.Add(float64(p95))
+	log.Println("memcached p95 latency:", p95)
+
+	if float64(p95) > highLatencyFrac*float64(slo) {
+		return true, false, "p95 latency close to SLO"
+	}
+	if !m.latency.Full() || m.latency.Estimate(cpustat.Max) > lowLatencyFrac*float64(slo) {
+		return false, false, ""
+	}
+	return false, true, "p95 latency well below SLO"
+}
@@ -0,0 +1,58 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"ethz.ch/ccsched/controller"
+)
+
+type Scheduler interface {
+	// Initialize the Scheduler and create jobs.
+	Init(ctx context.Context, cli *controller.Controller, jobs []controller.JobInfo) error
+
+	// Execute the scheduler until all jobs have completed or an unrecoverable error occurs.
+	Run(ctx context.Context, cli *controller.Controller) error
+}
+
+type Info struct {
+	Name        string
+	Description string
+}
+
+type registration struct {
+	Info
+	factory func() Scheduler
+}
+
+var registry = make(map[string]registration)
+
+// Make a scheduler available under the given name. Called from init functions.
+func Register(name, description string, factory func() Scheduler) {
+	if _, ok := registry[name]; ok {
+		panic("scheduler registered twice: " + name)
+	}
+	registry[name] = registration{Info{name, description}, factory}
+}
+
+// Create a new instance of the scheduler registered under name.
+func New(name string) (Scheduler, error) {
+	reg, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown scheduler %q", name)
+	}
+	return reg.factory(), nil
+}
+
+// All registered schedulers sorted by name.
+func List() []Info {
+	infos := make([]Info, 0, len(registry))
+	for _, reg := range registry {
+		infos = append(infos, reg.Info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
@@ -0,0 +1,353 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"ethz.ch/ccsched/controller"
+	"ethz.ch/ccsched/fake"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// Memcached throughput in percent of a single core.
+func constantLoad(percent float64) func(time.Duration) float64 {
+	return func(time.Duration) float64 { return percent }
+}
+
+// The PARSEC jobs of part 4.3.
+func parsecJobs() []controller.JobInfo {
+	return []controller.JobInfo{
+		{Name: "ferret", Threads: 2, Eta: 400 * time.Second},
+		{Name: "freqmine", Threads: 2, Eta: 270 * time.Second},
+		{Name: "blackscholes", Threads: 2, Eta: 150 * time.Second},
+		{Name: "splash2x-fft", Threads: 2, Eta: 120 * time.Second, BatchOnly: true},
+		{Name: "dedup", Threads: 1, Eta: 60 * time.Second},
+		{Name: "canneal", Threads: 1, Eta: 280 * time.Second},
+	}
+}
+
+var errTimeout = errors.New("simulated run took too long")
+
+// Fails once the simulated host has run for longer than limit, so that a scheduler
+// that never finishes fails the test instead of hanging it.
+type limitedSampler struct {
+	env   *fake.Env
+	limit time.Duration
+}
+
+func (s limitedSampler) Percent(interval time.Duration) ([]float64, error) {
+	if s.env.Runtime.Now().Sub(fake.Epoch) > s.limit {
+		return nil, errTimeout
+	}
+	return s.env.Sampler.Percent(interval)
+}
+
+// A controller of a simulated host, with memcached on its reserved cpus.
+func newController(env *fake.Env, reserved controller.CpuList) *controller.Controller {
+	cli := env.Controller()
+	cli.Reserved = reserved
+	cli.Sampler = limitedSampler{env: env, limit: 24 * time.Hour}
+	env.Memcached.SetCpuAffinity(context.Background(), cli.ReservedCpus())
+	return cli
+}
+
+// Run a scheduler until it is done.
+func runScheduler(t *testing.T, name string, cli *controller.Controller, jobs []controller.JobInfo) {
+	t.Helper()
+	sched, err := New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := sched.Init(ctx, cli, jobs); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if err := sched.Run(ctx, cli); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+}
+
+// Run a scheduler on a simulated host until all jobs have completed.
+func simulate(t *testing.T, name string, env *fake.Env, reserved controller.CpuList, jobs []controller.JobInfo) {
+	t.Helper()
+	runScheduler(t, name, newController(env, reserved), jobs)
+	if got := len(env.Runtime.Completed()); got != len(jobs) {
+		t.Fatalf("%v of %v jobs completed", got, len(jobs))
+	}
+}
+
+// Every scheduler finishes on small and large hosts, also while memcached keeps its cpus.
+func TestCpuCounts(t *testing.T) {
+	tests := []struct {
+		cpus     int
+		reserved controller.CpuList
+		load     float64
+	}{
+		{cpus: 2, load: 30},
+		{cpus: 3, load: 30},
+		{cpus: 3, load: 133},
+		{cpus: 4, reserved: controller.CpuList{0, 1, 2}, load: 133},
+		{cpus: 8, load: 30},
+		{cpus: 8, load: 133},
+	}
+	for _, name := range []string{"mc1", "mc1large", "static"} {
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%v/%vcpus/reserved=%v/load=%v", name, test.cpus, test.reserved, test.load), func(t *testing.T) {
+				env := fake.NewEnv(test.cpus, constantLoad(test.load))
+				simulate(t, name, env, test.reserved, parsecJobs())
+			})
+		}
+	}
+}
+
+// Memcached alternates between one and two busy cores.
+func burstyLoad(t time.Duration) float64 {
+	if t%(200*time.Second) < 100*time.Second {
+		return 30
+	}
+	return 133
+}
+
+// Completion order, pauses and makespan of the schedulers on a simulated 4-cpu host.
+func TestSchedulers(t *testing.T) {
+	tests := []struct {
+		sched    string
+		load     func(time.Duration) float64
+		loadName string
+		order    []string
+		pauses   map[string]int
+		makespan time.Duration
+	}{
+		{
+			sched: "mc1", load: constantLoad(30), loadName: "low",
+			order:    []string{"dedup", "splash2x-fft", "blackscholes", "canneal", "freqmine", "ferret"},
+			makespan: 15*time.Minute + 40*time.Second,
+		},
+		{
+			sched: "mc1", load: constantLoad(133), loadName: "high",
+			order:    []string{"splash2x-fft", "blackscholes", "freqmine", "ferret", "dedup", "canneal"},
+			makespan: 20*time.Minute + 20*time.Second,
+		},
+		{
+			sched: "mc1", load: burstyLoad, loadName: "bursty",
+			order:    []string{"dedup", "splash2x-fft", "blackscholes", "freqmine", "canneal", "ferret"},
+			pauses:   map[string]int{"canneal": 3},
+			makespan: 15*time.Minute + 40*time.Second,
+		},
+		{
+			sched: "mc1large", load: constantLoad(30), loadName: "low",
+			order:    []string{"dedup", "blackscholes", "freqmine", "canneal", "ferret", "splash2x-fft"},
+			makespan: 21*time.Minute + 20*time.Second,
+		},
+		{
+			sched: "mc1large", load: constantLoad(133), loadName: "high",
+			order:    []string{"splash2x-fft", "dedup", "blackscholes", "freqmine", "canneal", "ferret"},
+			makespan: 21*time.Minute + 20*time.Second,
+		},
+		{
+			sched: "mc1large", load: burstyLoad, loadName: "bursty",
+			order:    []string{"dedup", "blackscholes", "freqmine", "canneal", "ferret", "splash2x-fft"},
+			pauses:   map[string]int{"splash2x-fft": 1},
+			makespan: 21*time.Minute + 20*time.Second,
+		},
+		{
+			sched: "static", load: burstyLoad, loadName: "bursty",
+			order:    []string{"ferret", "freqmine", "blackscholes", "splash2x-fft", "dedup", "canneal"},
+			makespan: 20*time.Minute + 20*time.Second,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.sched+"/"+test.loadName, func(t *testing.T) {
+			env := fake.NewEnv(4, test.load)
+			jobs := parsecJobs()
+			simulate(t, test.sched, env, nil, jobs)
+
+			if got := env.Runtime.Completed(); !reflect.DeepEqual(got, test.order) {
+				t.Errorf("completion order %v, want %v", got, test.order)
+			}
+			for _, job := range jobs {
+				if got, want := env.Runtime.Pauses(job.Name), test.pauses[job.Name]; got != want {
+					t.Errorf("%v paused %v times, want %v", job.Name, got, want)
+				}
+			}
+			if got := env.Runtime.Makespan(); got != test.makespan {
+				t.Errorf("makespan %v, want %v", got, test.makespan)
+			}
+		})
+	}
+}
+
+// A runtime whose jobs exit as soon as they start, before any event can be delivered.
+type instantRuntime struct {
+	*fake.Runtime
+}
+
+func (rt instantRuntime) Start(ctx context.Context, id string) error {
+	if err := rt.Runtime.Start(ctx, id); err != nil {
+		return err
+	}
+	rt.Runtime.Advance(time.Millisecond)
+	return nil
+}
+
+// Jobs that exit before the scheduler listens for job events are noticed anyway.
+func TestEarlyExit(t *testing.T) {
+	for _, name := range []string{"mc1", "mc1large", "static"} {
+		t.Run(name, func(t *testing.T) {
+			env := fake.NewEnv(4, constantLoad(30))
+			cli := newController(env, nil)
+			cli.Runtime = instantRuntime{env.Runtime}
+			jobs := []controller.JobInfo{
+				{Name: "fails", Threads: 1},
+				{Name: "dedup", Threads: 1, Eta: 60 * time.Second},
+			}
+			env.Runtime.ExitCodes["fails"] = 1
+			runScheduler(t, name, cli, jobs)
+			if got := len(env.Runtime.Completed()); got != len(jobs) {
+				t.Fatalf("%v of %v jobs completed", got, len(jobs))
+			}
+		})
+	}
+}
+
+// Jobs wait for their dependencies, and those of a failed job are skipped.
+func TestDependencies(t *testing.T) {
+	chain := func() []controller.JobInfo {
+		return []controller.JobInfo{
+			{Name: "a", Threads: 1, Eta: 100 * time.Second},
+			{Name: "b", Threads: 1, Eta: 10 * time.Second, Dependencies: []string{"a"}},
+			{Name: "c", Threads: 2, Eta: 10 * time.Second, Dependencies: []string{"b"}},
+			{Name: "d", Threads: 1, Eta: 50 * time.Second},
+		}
+	}
+	tests := []struct {
+		name      string
+		exitCodes map[string]int
+		completed []string   // Jobs that ran, in any order.
+		after     [][]string // Jobs that started after another one exited.
+	}{
+		{
+			name:      "succeeded",
+			completed: []string{"a", "b", "c", "d"},
+			after:     [][]string{{"b", "a"}, {"c", "b"}},
+		},
+		{
+			name:      "failed",
+			exitCodes: map[string]int{"a": 1},
+			completed: []string{"a", "d"},
+		},
+		{
+			name:      "failed dependent",
+			exitCodes: map[string]int{"b": 2},
+			completed: []string{"a", "b", "d"},
+			after:     [][]string{{"b", "a"}},
+		},
+	}
+	for _, name := range []string{"mc1", "mc1large", "static"} {
+		for _, test := range tests {
+			t.Run(name+"/"+test.name, func(t *testing.T) {
+				env := fake.NewEnv(4, constantLoad(30))
+				for job, code := range test.exitCodes {
+					env.Runtime.ExitCodes[job] = code
+				}
+				cli := newController(env, nil)
+				runScheduler(t, name, cli, chain())
+
+				got := env.Runtime.Completed()
+				sort.Strings(got)
+				if !reflect.DeepEqual(got, test.completed) {
+					t.Errorf("jobs run %v, want %v", got, test.completed)
+				}
+				jobs := make(map[string]controller.JobSummary)
+				for _, job := range cli.Summary().Jobs {
+					jobs[job.Name] = job
+				}
+				for _, pair := range test.after {
+					job, dep := jobs[pair[0]], jobs[pair[1]]
+					if job.Started.Before(dep.Finished) {
+						t.Errorf("%v started at %v, before %v exited at %v", job.Name, job.Started, dep.Name, dep.Finished)
+					}
+				}
+			})
+		}
+	}
+}
+
+// A runtime that remembers every cpu each job has been pinned to.
+type pinRuntime struct {
+	*fake.Runtime
+	cpus map[string]map[int]bool
+}
+
+func (rt pinRuntime) SetCpuset(ctx context.Context, id string, cpuList controller.CpuList) error {
+	if rt.cpus[id] == nil {
+		rt.cpus[id] = make(map[int]bool)
+	}
+	for _, core := range cpuList {
+		rt.cpus[id][core] = true
+	}
+	return rt.Runtime.SetCpuset(ctx, id, cpuList)
+}
+
+// Batch-only jobs never run on the cpu that memcached lends.
+func TestBatchOnly(t *testing.T) {
+	for _, name := range []string{"mc1", "mc1large"} {
+		for _, load := range []float64{30, 133} {
+			t.Run(fmt.Sprintf("%v/load=%v", name, load), func(t *testing.T) {
+				env := fake.NewEnv(4, constantLoad(load))
+				cli := newController(env, nil)
+				rt := pinRuntime{env.Runtime, make(map[string]map[int]bool)}
+				cli.Runtime = rt
+				runScheduler(t, name, cli, parsecJobs())
+				if rt.cpus["splash2x-fft"][1] {
+					t.Errorf("splash2x-fft ran on the shared cpu 1")
+				}
+			})
+		}
+	}
+}
+
+// A runtime that fails to pause any job.
+type stuckRuntime struct {
+	*fake.Runtime
+}
+
+func (rt stuckRuntime) Pause(ctx context.Context, id string) error {
+	return fmt.Errorf("%w: cannot pause %v", controller.ErrConflict, id)
+}
+
+// Memcached gets its cpus back when it needs them, even if the jobs on them cannot be paused.
+func TestGrowWithStuckJobs(t *testing.T) {
+	// Idle for long enough to lend a cpu, then busy for a while.
+	load := func(t time.Duration) float64 {
+		if t >= 100*time.Second && t < 300*time.Second {
+			return 133
+		}
+		return 30
+	}
+	for _, name := range []string{"mc1", "mc1large"} {
+		t.Run(name, func(t *testing.T) {
+			// Jobs only get the cpu that memcached lends.
+			env := fake.NewEnv(2, load)
+			cli := newController(env, controller.CpuList{0, 1})
+			cli.Runtime = stuckRuntime{env.Runtime}
+			runScheduler(t, name, cli, parsecJobs())
+			// Pinned to both cpus at the start, then to one, and to both again.
+			if env.Memcached.Switches < 3 {
+				t.Errorf("memcached switched cpus %v times, want it shrunk and grown", env.Memcached.Switches)
+			}
+		})
+	}
+}
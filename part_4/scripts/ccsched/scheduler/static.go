@@ -2,87 +2,171 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"log"
+	"sort"
 	"time"
 
 	"ethz.ch/ccsched/controller"
-	"github.com/shirou/gopsutil/v3/cpu"
 )
 
 type StaticScheduler struct {
 	jobInfos      []controller.JobInfo
 	availableJobs []controller.JobInfo
 	runningJobs   map[string]controller.JobInfo
-	completedJobs int
+	cpus          cpuLayout
+	alloc         *CpuAllocator
+	ncpu          int // Number of cpus for jobs.
+	completedJobs int // Jobs that have exited, or have been skipped.
+	deps          *depGraph
+}
+
+func init() {
+	Register("static", "Memcached on its reserved cpus and jobs started in order on the other cpus",
+		func() Scheduler { return &StaticScheduler{} })
 }
 
 func (scheduler *StaticScheduler) JobInfos() []controller.JobInfo {
 	return scheduler.jobInfos
 }
 
-func (scheduler *StaticScheduler) Init(ctx context.Context, cli *controller.Controller) {
-	scheduler.jobInfos = []controller.JobInfo{
-		{Name: "blackscholes", Threads: 2},
-		{Name: "ferret", Threads: 2},
-		{Name: "freqmine", Threads: 2},
-		{Name: "dedup", Threads: 1},
-		{Name: "canneal", Threads: 1},
-		{Name: "splash2x-fft", Threads: 2},
+func (scheduler *StaticScheduler) Init(ctx context.Context, cli *controller.Controller, jobs []controller.JobInfo) error {
+	deps, err := newDepGraph(jobs)
+	if err != nil {
+		return err
 	}
+	scheduler.deps = deps
+
+	// Jobs run in manifest order, higher priorities first.
+	scheduler.jobInfos = append([]controller.JobInfo(nil), jobs...)
+	sort.SliceStable(scheduler.jobInfos, func(i, j int) bool {
+		return scheduler.jobInfos[i].Priority > scheduler.jobInfos[j].Priority
+	})
 
 	// Make all the jobs ready to run.
 	for _, job := range scheduler.jobInfos {
-		cli.CreateJob(ctx, &job)
+		if err := cli.CreateJob(ctx, &job); err != nil {
+			return err
+		}
 		scheduler.availableJobs = append(scheduler.availableJobs, job)
 	}
 
 	scheduler.runningJobs = make(map[string]controller.JobInfo)
 	scheduler.completedJobs = 0
+	return nil
+}
+
+func (scheduler *StaticScheduler) Run(ctx context.Context, cli *controller.Controller) error {
+	if err := cli.SetMemcachedCpuAffinity(ctx, cli.ReservedCpus()); err != nil {
+		log.Println(err)
+	}
+	// Memcached keeps all of its cpus, so that jobs only get the batch cpus.
+	var err error
+	if scheduler.cpus, err = newCpuLayout(cli); err != nil {
+		return err
+	}
+	scheduler.cpus.lendable = nil
+	if len(scheduler.cpus.batch) == 0 {
+		return errors.New("no cpus left for jobs besides the reserved ones")
+	}
+	scheduler.ncpu = len(scheduler.cpus.batch)
+	scheduler.alloc = NewCpuAllocator(cli.CpuTopology().Online())
+	if err := scheduler.alloc.Allocate(memcachedOwner, scheduler.cpus.reserved); err != nil {
+		return err
+	}
+
+	if err := scheduler.startJobs(ctx, cli); err != nil {
+		return err
+	}
+	// Sample cpu stats every second.
+	return runEventLoop(ctx, cli, time.Second, scheduler)
+}
+
+func (scheduler *StaticScheduler) done() bool {
+	return scheduler.completedJobs == len(scheduler.jobInfos)
+}
+
+func (scheduler *StaticScheduler) running() []string {
+	names := make([]string, 0, len(scheduler.runningJobs))
+	for jobName := range scheduler.runningJobs {
+		names = append(names, jobName)
+	}
+	return names
 }
 
-func (scheduler *StaticScheduler) Run(ctx context.Context, cli *controller.Controller) {
-	numJobs := len(scheduler.availableJobs)
-
-	cli.SetMemcachedCpuAffinity([]int{0, 1})
-	availableCpus := []int{2, 3}
-
-	for scheduler.completedJobs != numJobs {
-		if len(scheduler.availableJobs) > 0 {
-			// There are still jobs not running.
-			nextJob := scheduler.availableJobs[0]
-			if nextJob.Threads <= len(availableCpus) {
-				// Allocate the available cpu cores to the job.
-				cli.SetJobCpuAffinity(ctx, &nextJob, availableCpus[:nextJob.Threads])
-				availableCpus = availableCpus[nextJob.Threads:]
-
-				// Start the job.
-				cli.StartJob(ctx, nextJob.Name)
-				scheduler.runningJobs[nextJob.Name] = nextJob
-				scheduler.availableJobs = scheduler.availableJobs[1:]
+func (scheduler *StaticScheduler) jobExited(ctx context.Context, cli *controller.Controller, jobName string, exitCode int) error {
+	job, isRunning := scheduler.runningJobs[jobName]
+	if !isRunning {
+		return nil
+	}
+	// Job has completed.
+	scheduler.alloc.Release(job.Name)
+	scheduler.completedJobs++
+	log.Println("Completed job", jobName)
+	cli.RecordEvent(ctx, controller.Event{Type: controller.EventJobCompleted, Job: jobName, ExitCode: exitCode})
+	delete(scheduler.runningJobs, jobName)
+	// Jobs that depend on a failed one never run.
+	for _, skipped := range scheduler.deps.exited(jobName, exitCode) {
+		for i, job := range scheduler.availableJobs {
+			if job.Name == skipped {
+				scheduler.availableJobs = append(scheduler.availableJobs[:i], scheduler.availableJobs[i+1:]...)
+				break
 			}
 		}
+		scheduler.completedJobs++
+		recordSkipped(ctx, cli, skipped, jobName)
+	}
+	return scheduler.startJobs(ctx, cli)
+}
+
+func (scheduler *StaticScheduler) tick(ctx context.Context, cli *controller.Controller, sample controller.CpuSample) error {
+	logCpuSample(sample)
+	return nil
+}
+
+// The first job in order whose dependencies have completed, -1 if there is none.
+func (scheduler *StaticScheduler) nextJob() int {
+	for i, job := range scheduler.availableJobs {
+		if scheduler.deps.ready(job.Name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Start the next jobs in order as long as there are enough available cpus.
+func (scheduler *StaticScheduler) startJobs(ctx context.Context, cli *controller.Controller) error {
+	for {
+		// There are still jobs ready to run.
+		next := scheduler.nextJob()
+		if next < 0 {
+			return nil
+		}
+		nextJob := scheduler.availableJobs[next]
+		// Jobs with more threads than cpus share all of them.
+		ncpu := nextJob.Threads
+		if ncpu > scheduler.ncpu {
+			ncpu = scheduler.ncpu
+		}
+		cpus, ok := scheduler.cpus.pick(scheduler.alloc.Free(scheduler.cpus.batch), ncpu)
+		if !ok {
+			return nil
+		}
 
-		// Block for one second to get cpu stats.
-		cpuUsage, err := cpu.Percent(time.Second, true)
+		// Allocate the available cpu cores to the job.
+		if err := scheduler.alloc.Allocate(nextJob.Name, cpus); err != nil {
+			return err
+		}
+		err := cli.SetJobCpuAffinity(ctx, &nextJob, cpus)
 		if err != nil {
-			log.Println("Error geting cpu usage:", err)
-		} else {
-			log.Println("cpu usage: ", cpuUsage)
+			return err
 		}
 
-		// Check for completed jobs.
-		for jobName, job := range scheduler.runningJobs {
-			res, err := cli.ContainerInspect(ctx, jobName)
-			if err != nil {
-				log.Fatal(err)
-			}
-			if res.State.Status == "exited" {
-				// Job has completed.
-				availableCpus = append(availableCpus, job.CpuList...)
-				scheduler.completedJobs++
-				log.Println("Completed job", jobName)
-				delete(scheduler.runningJobs, jobName)
-			}
+		// Start the job.
+		if err := cli.StartJob(ctx, nextJob.Name); err != nil {
+			return err
 		}
+		scheduler.runningJobs[nextJob.Name] = nextJob
+		scheduler.availableJobs = append(scheduler.availableJobs[:next], scheduler.availableJobs[next+1:]...)
 	}
 }
@@ -0,0 +1,67 @@
+// Package sim runs schedulers on a simulated host: jobs scale by measured speedup curves,
+// and memcached serves a load replayed from the QPS schedule of an mcperf run.
+package sim
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"ethz.ch/ccsched/controller"
+	"ethz.ch/ccsched/fake"
+)
+
+// Host setup of a simulation.
+type Config struct {
+	Cpus     int
+	Reserved controller.CpuList            // Cpus of memcached, the first two by default.
+	Load     func(t time.Duration) float64 // Memcached load in percent of a single core, see QpsTrace.Load.
+	Specs    map[string]JobSpec            // Jobs without a spec need their Eta on every thread.
+
+	Latency      bool // Steer memcached by its simulated p95 latency instead of cpu usage.
+	Pressure     bool // Steer memcached by its simulated cpu stalls too.
+	PressureOnly bool // Steer memcached by its simulated cpu stalls only.
+}
+
+// Create a simulated host for the jobs, and a controller that drives it.
+// Memcached starts out on the cpus reserved for it, like after run_scheduler.sh.
+func NewHost(cfg Config, jobs []controller.JobInfo) (*fake.Env, *controller.Controller) {
+	env := fake.NewEnv(cfg.Cpus, cfg.Load)
+	for _, job := range jobs {
+		if spec, ok := cfg.Specs[job.Name]; ok {
+			env.Runtime.Work[job.Name] = spec.Work()
+			env.Runtime.Speedup[job.Name] = spec.Speedup()
+		}
+	}
+	cli := env.Controller()
+	cli.Reserved = cfg.Reserved
+	if cfg.Latency {
+		cli.Latency = env.Latency
+	}
+	if cfg.Pressure || cfg.PressureOnly {
+		cli.Pressure = env.Pressure
+		cli.PressureOnly = cfg.PressureOnly
+	}
+	env.Memcached.SetCpuAffinity(context.Background(), cli.ReservedCpus())
+	env.Memcached.Switches = 0
+	return env, cli
+}
+
+// LogWriter stamps log lines with the simulated time, for use with log.SetFlags(0).
+type LogWriter struct {
+	Clock controller.Clock
+	W     io.Writer
+
+	mu sync.Mutex
+}
+
+func (w *LogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stamp := w.Clock.Now().Format("2006/01/02 15:04:05 ")
+	if _, err := io.WriteString(w.W, stamp); err != nil {
+		return 0, err
+	}
+	return w.W.Write(p)
+}
@@ -0,0 +1,122 @@
+package sim
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Run times of the PARSEC jobs on 1 to 8 threads, measured in part 2b.
+//
+//go:embed parsec.json
+var parsecSpec []byte
+
+// How a simulated job scales, from its run time on a number of cores, e.g.
+//
+//	{"jobs": [
+//	  {"name": "ferret", "run_times": {"1": "758s", "2": "390s", "4": "225s", "8": "195s"}}
+//	]}
+//
+// The job needs its single-core run time of work. Its speedup is interpolated linearly
+// between the measured core counts, and stays flat beyond the largest one.
+type JobSpec struct {
+	Name     string
+	RunTimes map[int]time.Duration
+}
+
+type jobSpec struct {
+	Name     string            `json:"name"`
+	RunTimes map[string]string `json:"run_times"`
+}
+
+type specFile struct {
+	Jobs []jobSpec `json:"jobs"`
+}
+
+// Parse a JSON job spec, by job name.
+func ParseSpec(r io.Reader) (map[string]JobSpec, error) {
+	var f specFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, err
+	}
+	specs := make(map[string]JobSpec)
+	for _, s := range f.Jobs {
+		spec := JobSpec{Name: s.Name, RunTimes: make(map[int]time.Duration)}
+		for cores, runTime := range s.RunTimes {
+			n, err := strconv.Atoi(cores)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("job %v: invalid core count %q", s.Name, cores)
+			}
+			d, err := time.ParseDuration(runTime)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("job %v: invalid run time %q", s.Name, runTime)
+			}
+			spec.RunTimes[n] = d
+		}
+		if _, ok := spec.RunTimes[1]; !ok {
+			return nil, fmt.Errorf("job %v: no run time on a single core", s.Name)
+		}
+		specs[s.Name] = spec
+	}
+	return specs, nil
+}
+
+// Load a JSON job spec file.
+func LoadSpec(file string) (map[string]JobSpec, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	specs, err := ParseSpec(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", file, err)
+	}
+	return specs, nil
+}
+
+// The specs of the PARSEC jobs as measured in part 2b.
+func ParsecSpec() map[string]JobSpec {
+	specs, err := ParseSpec(bytes.NewReader(parsecSpec))
+	if err != nil {
+		panic(err)
+	}
+	return specs
+}
+
+// Cpu time the job needs on a single core.
+func (s JobSpec) Work() time.Duration {
+	return s.RunTimes[1]
+}
+
+// Speedup of the job on a number of cores over a single core.
+func (s JobSpec) Speedup() func(cores float64) float64 {
+	counts := make([]int, 0, len(s.RunTimes))
+	for n := range s.RunTimes {
+		counts = append(counts, n)
+	}
+	sort.Ints(counts)
+	// Measured points, starting from no progress on no core.
+	xs := []float64{0}
+	ys := []float64{0}
+	for _, n := range counts {
+		xs = append(xs, float64(n))
+		ys = append(ys, float64(s.RunTimes[1])/float64(s.RunTimes[n]))
+	}
+	return func(cores float64) float64 {
+		for i := 1; i < len(xs); i++ {
+			if cores <= xs[i] {
+				return ys[i-1] + (ys[i]-ys[i-1])*(cores-xs[i-1])/(xs[i]-xs[i-1])
+			}
+		}
+		return ys[len(ys)-1]
+	}
+}
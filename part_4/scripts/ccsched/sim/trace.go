@@ -0,0 +1,104 @@
+package sim
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Memcached throughput that keeps one core busy, a rough fit of the part 4.1 measurements.
+const DefaultQpsPerCore = 60000
+
+// QpsTrace is the load put on memcached over time: a target throughput per interval,
+// repeated once it runs out.
+type QpsTrace struct {
+	Start    time.Time // When mcperf started, if known.
+	Interval time.Duration
+	Qps      []float64
+}
+
+// Read the QPS schedule that mcperf prints at the start of its output, e.g. in latencies.raw:
+//
+//	Total number of intervals = 600 (5031, 54838, ...)
+//	...
+//	Timestamp start: 1622066325838
+//	Timestamp end: 1622068126346
+//
+// The interval is derived from the timestamps if they are there, interval otherwise.
+func ParseQpsTrace(r io.Reader, interval time.Duration) (*QpsTrace, error) {
+	trace := &QpsTrace{Interval: interval}
+	var start, end int64
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20) // The schedule is a single long line.
+scan:
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "Total number of intervals"):
+			open, close := strings.Index(line, "("), strings.LastIndex(line, ")")
+			if open < 0 || close < open {
+				return nil, fmt.Errorf("malformed QPS schedule: %.60q", line)
+			}
+			for _, field := range strings.Split(line[open+1:close], ",") {
+				qps, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+				if err != nil {
+					return nil, fmt.Errorf("QPS schedule: %w", err)
+				}
+				trace.Qps = append(trace.Qps, qps)
+			}
+		case strings.HasPrefix(line, "Timestamp start:"):
+			start, _ = strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "Timestamp start:")), 10, 64)
+		case strings.HasPrefix(line, "Timestamp end:"):
+			end, _ = strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "Timestamp end:")), 10, 64)
+		case strings.HasPrefix(line, "#type"):
+			// Only measurements follow.
+			break scan
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(trace.Qps) == 0 {
+		return nil, fmt.Errorf("no QPS schedule found")
+	}
+	if start > 0 && end > start {
+		// Timestamps are in milliseconds; the run ends a fraction of a second late.
+		trace.Start = time.Unix(0, start*int64(time.Millisecond)).UTC()
+		trace.Interval = (time.Duration(end-start) * time.Millisecond / time.Duration(len(trace.Qps))).Round(time.Second)
+	}
+	if trace.Interval <= 0 {
+		return nil, fmt.Errorf("unknown QPS interval")
+	}
+	return trace, nil
+}
+
+// Load the QPS schedule of an mcperf output file.
+func LoadQpsTrace(file string, interval time.Duration) (*QpsTrace, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	trace, err := ParseQpsTrace(f, interval)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", file, err)
+	}
+	return trace, nil
+}
+
+// The target throughput at a time since the start of the trace.
+func (t *QpsTrace) At(since time.Duration) float64 {
+	i := int(since/t.Interval) % len(t.Qps)
+	return t.Qps[i]
+}
+
+// The cpu load of memcached, in percent of a single core, at a time since the start.
+func (t *QpsTrace) Load(qpsPerCore float64) func(time.Duration) float64 {
+	return func(since time.Duration) float64 {
+		return 100 * t.At(since) / qpsPerCore
+	}
+}
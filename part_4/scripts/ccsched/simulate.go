@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"ethz.ch/ccsched/controller"
+	"ethz.ch/ccsched/fake"
+	"ethz.ch/ccsched/scheduler"
+	"ethz.ch/ccsched/sim"
+)
+
+// Settings of a run shared with simulations.
+type runFlags struct {
+	schedName string
+	jobs      []controller.JobInfo
+	reserved  controller.CpuList
+	placement controller.PlacementPolicy
+	slo       time.Duration
+	psiMode   string
+}
+
+func simulateUsage(fs *flag.FlagSet) func() {
+	return func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: ccsched [--scheduler <name>] [--jobs <manifest.json>] [--reserved-cpus <cpus>] [--slo <latency>] [--psi with-usage|only]")
+		fmt.Fprintln(out, "               simulate [flags] <result-dir>")
+		fs.PrintDefaults()
+	}
+}
+
+// Run the scheduler on a simulated host, writing the same results as a real run.
+// Simulated runs are not recorded in the history, nor do they teach the job ETAs.
+func runSimulation(ctx context.Context, run runFlags, args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	cpus := fs.Int("cpus", 4, "number of simulated cpus")
+	traceFile := fs.String("trace", "", "mcperf output whose QPS schedule memcached serves, e.g. latencies.raw")
+	qps := fs.Float64("qps", 0, "constant memcached throughput, without --trace")
+	qpsInterval := fs.Duration("qps-interval", 10*time.Second, "interval of the QPS schedule, if the trace has no timestamps")
+	qpsPerCore := fs.Float64("qps-per-core", sim.DefaultQpsPerCore, "memcached throughput that keeps one core busy")
+	specFile := fs.String("spec", "", "JSON run times of the jobs per core count (default: the PARSEC jobs of part 2b)")
+	latency := fs.Bool("latency", false, "steer memcached by its simulated p95 latency instead of cpu usage")
+	fs.Usage = simulateUsage(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	resultDir := fs.Arg(0)
+
+	specs := sim.ParsecSpec()
+	if *specFile != "" {
+		var err error
+		if specs, err = sim.LoadSpec(*specFile); err != nil {
+			return err
+		}
+	}
+	load := func(time.Duration) float64 { return 100 * *qps / *qpsPerCore }
+	if *traceFile != "" {
+		trace, err := sim.LoadQpsTrace(*traceFile, *qpsInterval)
+		if err != nil {
+			return err
+		}
+		load = trace.Load(*qpsPerCore)
+	}
+	cfg := sim.Config{
+		Cpus:         *cpus,
+		Reserved:     run.reserved,
+		Load:         load,
+		Specs:        specs,
+		Latency:      *latency,
+		Pressure:     run.psiMode != "",
+		PressureOnly: run.psiMode == "only",
+	}
+	return simulate(ctx, run, cfg, resultDir, nil)
+}
+
+// Run the scheduler on the simulated host of cfg, writing the same results as a real run.
+// setup, if any, adjusts the host and controller before the run. Errors of the scheduler
+// are returned once the results are written, unless the run was interrupted.
+func simulate(ctx context.Context, run runFlags, cfg sim.Config, resultDir string, setup func(*fake.Env, *controller.Controller)) error {
+	if len(run.reserved) > 0 {
+		if err := controller.UniformTopology(cfg.Cpus).CheckReserved(run.reserved); err != nil {
+			return err
+		}
+	}
+	sched, err := scheduler.New(run.schedName)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(resultDir, 0755); err != nil {
+		return err
+	}
+	logFile, err := os.Create(path.Join(resultDir, "scheduler.log"))
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	eventLog, err := controller.OpenEventLog(path.Join(resultDir, "events.jsonl"))
+	if err != nil {
+		return err
+	}
+	defer eventLog.Close()
+
+	env, cli := sim.NewHost(cfg, run.jobs)
+	cli.Placement = run.placement
+	cli.SLO = run.slo
+	cli.EventLog = eventLog
+	if setup != nil {
+		setup(env, cli)
+	}
+	log.SetFlags(0)
+	log.SetOutput(&sim.LogWriter{Clock: env.Runtime, W: io.MultiWriter(logFile, os.Stdout)})
+
+	log.Printf("Simulating %v cpus, reserved for memcached: %v", cfg.Cpus, cli.ReservedCpus())
+	log.Printf("Running with scheduler %v (%T)", run.schedName, sched)
+	runErr := sched.Init(ctx, cli, run.jobs)
+	if runErr != nil {
+		runErr = fmt.Errorf("initialize scheduler: %w", runErr)
+	} else if runErr = sched.Run(ctx, cli); runErr != nil {
+		runErr = fmt.Errorf("run scheduler: %w", runErr)
+	}
+	if runErr != nil {
+		log.Println("Error:", runErr)
+	}
+
+	cleanupCtx := controller.WithReason(context.Background(), controller.ReasonShutdown)
+	cli.StopJobs(cleanupCtx, run.jobs)
+	if err := cli.WriteLogs(cleanupCtx, resultDir, run.jobs); err != nil {
+		log.Println("Error writing logs:", err)
+	}
+	summary := cli.Summary()
+	if err := summary.Write(resultDir); err != nil {
+		log.Println("Error writing summary:", err)
+	}
+	summary.WriteTable(os.Stdout)
+	if ctx.Err() != nil {
+		// Interrupted: the partial results are all there is.
+		return nil
+	}
+	return runErr
+}
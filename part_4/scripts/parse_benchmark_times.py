@@ -1,3 +1,4 @@
+import json
 import numpy as np
 import os
 import time
@@ -54,6 +55,32 @@ def parse_scheduler_log(logfile, start_ts):
     return end_time, bm_intervals
 
 
+def parse_event_log(eventfile, start_ts):
+    # Same as parse_scheduler_log, from the JSON-lines event log written by ccsched.
+    bm_intervals = {}
+    bm_open = {}
+    end_time = 0
+
+    with open(eventfile) as f:
+        for line in f:
+            event = json.loads(line)
+            rel_time = (event['ts_ms'] - start_ts) / 1000.
+            end_time = max(end_time, rel_time)
+            job_name = event.get('job')
+
+            if event['type'] in ('job_started', 'job_unpaused'):
+                bm_open[job_name] = rel_time
+
+            elif event['type'] in ('job_paused', 'job_completed', 'job_stopped'):
+                # A job that exits or is stopped while paused has no interval open
+                start = bm_open.pop(job_name, None)
+                if start is not None:
+                    bm_intervals.setdefault(job_name, []).append(
+                        (start, rel_time - start))
+
+    return end_time, bm_intervals
+
+
 def extract_times(rep_dir):
     # Get the start timestamp from the raw latency file
     start_ts = None
@@ -64,9 +91,13 @@ def extract_times(rep_dir):
             if line.startswith('Timestamp start: '):
                 start_ts = int(line[len('Timestamp start: '):])
 
-    # Parse scheduler log
-    end_time, bm_intervals = parse_scheduler_log(
-        os.path.join(rep_dir, 'scheduler.log'), start_ts)
+    # Prefer the event log, older runs only have the scheduler log
+    event_log = os.path.join(rep_dir, 'events.jsonl')
+    if os.path.exists(event_log):
+        end_time, bm_intervals = parse_event_log(event_log, start_ts)
+    else:
+        end_time, bm_intervals = parse_scheduler_log(
+            os.path.join(rep_dir, 'scheduler.log'), start_ts)
 
     times = {}
 
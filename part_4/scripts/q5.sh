@@ -4,6 +4,7 @@
 set -x
 
 login_key=$HOME/.ssh/cloud-computing
+scheduler_policy=${SCHEDULER_POLICY:-mc1}
 
 qps_interval=3
 
@@ -27,6 +28,17 @@ env GOOS=linux GOARCH=amd64 go build -o build/${SCHEDULER_NAME}
 gcloud compute scp --ssh-key-file=${login_key} \
   build/${SCHEDULER_NAME} \
   ubuntu@${MEMCACHED_NAME}:~/${SCHEDULER_NAME}
+# Let the scheduler pin the threads of memcached without sudo.
+gcloud compute ssh --ssh-key-file=${login_key} ubuntu@${MEMCACHED_NAME} \
+  --command="sudo setcap cap_sys_nice+ep ~/${SCHEDULER_NAME}"
+# Run the policy with the job table of its experiments, if it has one.
+jobs_flag=
+if [ -f jobs/${scheduler_policy}.json ]; then
+  gcloud compute scp --ssh-key-file=${login_key} \
+    jobs/${scheduler_policy}.json \
+    ubuntu@${MEMCACHED_NAME}:~/jobs_${scheduler_policy}.json
+  jobs_flag="--jobs jobs_${scheduler_policy}.json"
+fi
 cd ..
 
 res_dir=${RESULTS_DIR}
@@ -68,7 +80,7 @@ for i in $(seq 1 3); do
   current_ts=$(date -u +"%Y-%m-%dT%H-%M-%SZ")
   scheduler_res="scheduler_${current_ts}"
   gcloud compute ssh --ssh-key-file=${login_key} ubuntu@${MEMCACHED_NAME} \
-    --command="./${SCHEDULER_NAME} ${scheduler_res}"
+    --command="./${SCHEDULER_NAME} --scheduler ${scheduler_policy} ${jobs_flag} ${scheduler_res}"
 
   # Copy scheduler results to host machine
   gcloud compute scp --recurse --ssh-key-file=${login_key} \